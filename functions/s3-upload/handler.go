@@ -2,23 +2,91 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net/url"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/ellery44/data-loader/internal/dataloader"
 	_ "github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Name the handler's spans are reported under.
+const instrumentationName = "github.com/ellery44/data-loader/functions/s3-upload"
+
+// Response Core response object for if processing is successful
+type Response struct {
+	Success bool `json:"success"`
+	// What the load of each data file in the event did
+	Results []*dataloader.LoadResult `json:"results,omitempty"`
+	// Keys of the data files that failed permanently and were moved into quarantine
+	Quarantined []string `json:"quarantined,omitempty"`
+}
+
 type handler struct {
 	dl *dataloader.DataLoader
 }
 
+// Loads the data file of each record. Files failing permanently are quarantined and acked, any other failure is
+// returned so the event is retried.
 func (h *handler) handle(ctx context.Context, s3Event events.S3Event) (*Response, error) {
-	var err error
+	var failed error
+	rsp := &Response{Success: true}
 	for _, record := range s3Event.Records {
-		err = h.dl.LoadDataFileToRedshift(ctx, record.S3.Object.Key)
+		key, err := objectKey(record)
+		if err != nil {
+			failed = err
+			continue
+		}
+		// Staged and quarantined copies are written back into the data bucket by the loader itself
+		if dataloader.IsStagingKey(key) || dataloader.IsQuarantineKey(key) {
+			continue
+		}
+		if err := h.handleRecord(ctx, record, key, rsp); err != nil {
+			failed = err
+		}
 	}
+	if failed != nil {
+		return nil, failed
+	}
+	return rsp, nil
+}
+
+// Returns the key of the object a record is about. S3 events carry keys URL encoded, spaces as '+'.
+func objectKey(record events.S3EventRecord) (string, error) {
+	key, err := url.QueryUnescape(record.S3.Object.Key)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("decoding key %q: %w", record.S3.Object.Key, err)
+	}
+	return key, nil
+}
+
+// Loads the data file at key of one record in its own span, quarantining it when it fails permanently.
+func (h *handler) handleRecord(ctx context.Context, record events.S3EventRecord, key string, rsp *Response) (err error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "HandleRecord", trace.WithAttributes(
+		attribute.String("data_loader.bucket", record.S3.Bucket.Name),
+		attribute.String("data_loader.key", key),
+		attribute.String("data_loader.event_name", record.EventName),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	result, err := h.dl.LoadDataFileToRedshift(ctx, key)
+	rsp.Results = append(rsp.Results, result)
+	if dataloader.IsPermanent(err) {
+		// Retrying fails the same way until the file or its definition is fixed
+		if err = h.dl.QuarantineDataFile(ctx, key, err); err == nil {
+			rsp.Quarantined = append(rsp.Quarantined, key)
+			span.SetAttributes(attribute.Bool("data_loader.quarantined", true))
+		}
 	}
-	return &Response{Success: true}, nil
+	return err
 }
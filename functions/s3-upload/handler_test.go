@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ellery44/data-loader/internal/dataloader"
+	"github.com/ellery44/data-loader/internal/s3test"
+	"github.com/go-kit/kit/log"
+	"github.com/lib/pq"
+)
+
+// recordingExecutor is an in-memory dataloader.Executor recording every statement it runs, BEGIN included. Starting
+// a transaction fails with beginErr when it's set, other statements succeed and queries return no rows.
+type recordingExecutor struct {
+	statements []string
+	beginErr   error
+}
+
+func (e *recordingExecutor) BeginTx(ctx context.Context) (dataloader.Tx, error) {
+	e.statements = append(e.statements, "BEGIN")
+	if e.beginErr != nil {
+		return nil, e.beginErr
+	}
+	return &recordingTx{e}, nil
+}
+
+func (e *recordingExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.statements = append(e.statements, query)
+	return recordedResult(0), nil
+}
+
+func (e *recordingExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (dataloader.Rows, error) {
+	e.statements = append(e.statements, query)
+	return noRows{}, nil
+}
+
+func (e *recordingExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) dataloader.Row {
+	e.statements = append(e.statements, query)
+	return noRows{}
+}
+
+type recordingTx struct {
+	*recordingExecutor
+}
+
+func (t *recordingTx) Commit() error {
+	t.statements = append(t.statements, "COMMIT")
+	return nil
+}
+
+func (t *recordingTx) Rollback() error {
+	t.statements = append(t.statements, "ROLLBACK")
+	return nil
+}
+
+// recordedResult is the sql.Result of a recorded statement, affecting that many rows.
+type recordedResult int64
+
+func (r recordedResult) LastInsertId() (int64, error) { return 0, errors.New("no insert ID") }
+func (r recordedResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+type noRows struct{}
+
+func (noRows) Next() bool                     { return false }
+func (noRows) Scan(dest ...interface{}) error { return sql.ErrNoRows }
+func (noRows) Err() error                     { return nil }
+func (noRows) Close() error                   { return nil }
+
+// Returns an event for objects created at the passed keys, encoded the way S3 sends them.
+func createdEvent(keys ...string) events.S3Event {
+	var event events.S3Event
+	for _, key := range keys {
+		event.Records = append(event.Records, events.S3EventRecord{
+			EventName: "ObjectCreated:Put",
+			S3: events.S3Entity{
+				Bucket: events.S3Bucket{Name: "data"},
+				Object: events.S3Object{Key: key},
+			},
+		})
+	}
+	return event
+}
+
+func TestHandle(t *testing.T) {
+	const dataFile = "Foonyor   1  1\n"
+	tests := []struct {
+		name        string
+		key         string
+		stored      string
+		noSchema    bool
+		beginErr    error
+		transient   bool
+		quarantined []string
+		statements  bool
+	}{
+		{name: "staging-key", key: "staging/testformat1_2015-06-28.txt", stored: "staging/testformat1_2015-06-28.txt"},
+		{name: "quarantine-key", key: "quarantine/testformat1_2015-06-28.txt", stored: "quarantine/testformat1_2015-06-28.txt"},
+		{
+			name:        "permanent-failure-quarantined",
+			key:         "testformat1_2015-06-28+%282%29.txt",
+			stored:      "testformat1_2015-06-28 (2).txt",
+			noSchema:    true,
+			quarantined: []string{"testformat1_2015-06-28 (2).txt"},
+		},
+		{
+			name:       "transient-failure-returned",
+			key:        "testformat1_2015-06-28.txt",
+			stored:     "testformat1_2015-06-28.txt",
+			beginErr:   &pq.Error{Code: "08006", Message: "connection failure"},
+			transient:  true,
+			statements: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Svc := &s3test.Fake{}
+			s3Svc.Put("data", tt.stored, dataFile)
+			if !tt.noSchema {
+				if err := s3Svc.LoadDir("schemas", "../../test-data"); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			db := &recordingExecutor{beginErr: tt.beginErr}
+			h := handler{dl: &dataloader.DataLoader{
+				DB:           db,
+				Logger:       log.NewNopLogger(),
+				DataBucket:   "data",
+				SchemaBucket: "schemas",
+				S3Svc:        s3Svc,
+				Retry:        dataloader.RetryPolicy{MaxAttempts: 1},
+			}}
+
+			rsp, err := h.handle(context.Background(), createdEvent(tt.key))
+			if dataloader.IsTransient(err) != tt.transient || (err != nil && !tt.transient) {
+				t.Fatalf("want transient error: %v, got: %v", tt.transient, err)
+			}
+			if tt.transient {
+				if rsp != nil {
+					t.Errorf("want no response with the error, got: %+v", rsp)
+				}
+				if _, ok := s3Svc.Object("data", tt.stored); !ok {
+					t.Errorf("want %s left in place to be retried", tt.stored)
+				}
+			} else if !reflect.DeepEqual(tt.quarantined, rsp.Quarantined) {
+				t.Errorf("want quarantined: %v, got: %v", tt.quarantined, rsp.Quarantined)
+			}
+			if (len(db.statements) > 0) != tt.statements {
+				t.Errorf("want statements run: %v, got: %v", tt.statements, db.statements)
+			}
+
+			for _, key := range tt.quarantined {
+				if _, ok := s3Svc.Object("data", key); ok {
+					t.Errorf("want %s moved out of the data prefix", key)
+				}
+				if body, _ := s3Svc.Object("data", dataloader.QuarantinePrefix+key); body != dataFile {
+					t.Errorf("want %s quarantined, got: %q", key, body)
+				}
+				if reason, _ := s3Svc.Object("data", dataloader.QuarantinePrefix+key+".error"); !strings.Contains(reason, "NoSuchKey") {
+					t.Errorf("want the reason next to %s, got: %q", key, reason)
+				}
+			}
+			if len(tt.quarantined) == 0 {
+				if _, ok := s3Svc.Object("data", tt.stored); !ok {
+					t.Errorf("want %s left where it was", tt.stored)
+				}
+			}
+		})
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	record := createdEvent("bad%zzkey").Records[0]
+	if _, err := objectKey(record); err == nil {
+		t.Error("want an error for a malformed key")
+	}
+}
@@ -0,0 +1,95 @@
+// +build local
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ellery44/data-loader/internal/dataloader"
+	"github.com/go-kit/kit/log"
+)
+
+// Prints the load history recorded in the database at -dsn, most recent first:
+//
+//	go run -tags local ./functions/s3-upload history -table raw.orders -from 2018-11-01 -status failed
+func history(args []string) error {
+	var (
+		flags        = flag.NewFlagSet("history", flag.ExitOnError)
+		dsn          = flags.String("dsn", defaultDSN, "database the history is recorded in")
+		historyTable = flags.String("history-table", dataloader.DefaultHistoryTable, "load history table")
+		table        = flags.String("table", "", "only loads into this table, qualified with its schema if it has one")
+		from         = flags.String("from", "", "only loads started on or after this date, YYYY-MM-DD or RFC 3339")
+		to           = flags.String("to", "", "only loads started before this date, YYYY-MM-DD or RFC 3339")
+		status       = flags.String("status", "", "only loads with this status, succeeded or failed")
+		limit        = flags.Int("limit", 50, "most recent loads shown at most, 0 for all")
+		asJSON       = flags.Bool("json", false, "print one JSON object per load instead of a table")
+	)
+	flags.Parse(args)
+
+	filter := dataloader.HistoryFilter{Table: *table, Status: *status, Limit: *limit}
+	var err error
+	if filter.From, err = parseHistoryTime(*from); err != nil {
+		return err
+	}
+	if filter.To, err = parseHistoryTime(*to); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	dl := &dataloader.DataLoader{
+		DB:           dataloader.NewSQLExecutor(db),
+		Logger:       log.NewNopLogger(),
+		HistoryTable: *historyTable,
+	}
+	entries, err := dl.LoadHistory(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, entry := range entries {
+			if err = encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "STARTED\tTABLE\tKEY\tMODE\tROWS\tREJECTED\tDURATION\tSTATUS\tERROR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			entry.StartedAt.Format(time.RFC3339),
+			entry.Table,
+			entry.Key,
+			entry.Mode,
+			entry.RowsLoaded,
+			entry.RowsRejected,
+			entry.Duration,
+			entry.Status,
+			entry.Error)
+	}
+	return w.Flush()
+}
+
+// Parses a -from or -to flag, the zero time when unset.
+func parseHistoryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -1,4 +1,4 @@
-// +build !test
+// +build !test,!local
 
 package main
 
@@ -7,23 +7,33 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-lambda-go/lambdacontext"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/redshift"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/ellery44/data-loader/internal/dataapi"
 	"github.com/ellery44/data-loader/internal/dataloader"
+	"github.com/ellery44/data-loader/internal/dbconn"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
-// Response Core response object for if processing is successful
-type Response struct {
-	Success bool `json:"success"`
-}
-
 func main() {
 
 	var (
@@ -34,6 +44,10 @@ func main() {
 		env          = os.Getenv("ENVIRONMENT_NAME")
 		dataBucket   = os.Getenv("DATA_BUCKET")
 		schemaBucket = os.Getenv("SCHEMA_BUCKET")
+		dbBackend    = os.Getenv("DB_BACKEND")
+		dbTarget     = os.Getenv("DB_TARGET")
+		historyTable = os.Getenv("LOAD_HISTORY_TABLE")
+		dbName       = fmt.Sprintf("data-loader-%s", env)
 	)
 
 	if env == "" {
@@ -45,40 +59,55 @@ func main() {
 	if schemaBucket == "" {
 		panic("SCHEMA_BUCKET undefined")
 	}
-
-	// Fetch DB password
-	passwordRsp, err := ssmSvc.GetParameter(&ssm.GetParameterInput{
-		Name:           aws.String(fmt.Sprintf("/data-loader/%s/master-password", env)),
-		WithDecryption: aws.Bool(true),
-	})
-	if err != nil {
-		panic(err)
+	if dbTarget != "" && dbTarget != dataloader.TargetRedshift && dbTarget != dataloader.TargetPostgres {
+		panic(fmt.Sprintf("unknown DB_TARGET %s", dbTarget))
 	}
-	// Fetch cluster endpoint
-	endpointRsp, err := ssmSvc.GetParameter(&ssm.GetParameterInput{
-		Name:           aws.String(fmt.Sprintf("/data-loader/%s/cluster-endpoint", env)),
-		WithDecryption: aws.Bool(true),
-	})
-	if err != nil {
-		panic(err)
+
+	// Pick how SQL reaches the cluster, a connection pool unless the Data API is configured
+	var db dataloader.Executor
+	switch dbBackend {
+	case "", "sql":
+		db = dataloader.NewSQLExecutor(openDatabase(sess, ssmSvc, env, dbName))
+	case "dataapi":
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			panic(err)
+		}
+		db = &dataapi.Executor{
+			Svc:               redshiftdata.NewFromConfig(cfg),
+			ClusterIdentifier: os.Getenv("CLUSTER_IDENTIFIER"),
+			WorkgroupName:     os.Getenv("WORKGROUP_NAME"),
+			Database:          dbName,
+			DBUser:            os.Getenv("DB_USER"),
+			SecretArn:         os.Getenv("DB_SECRET_ARN"),
+		}
+	default:
+		panic(fmt.Sprintf("unknown DB_BACKEND %s", dbBackend))
 	}
 
-	// Establish DB connection
-	db, err := sql.Open("postgres",
-		fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
-			*endpointRsp.Parameter.Value,
-			5439,
-			"admin",
-			*passwordRsp.Parameter.Value,
-			fmt.Sprintf("data-loader-%s", env)),
-	)
-	if err != nil {
-		panic(err)
+	// Loads only insert into the history table, create it once per container instead of in every load. Recording
+	// history is best effort, a failure here only leaves the inserts to fail and be logged.
+	if historyTable != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		dl := &dataloader.DataLoader{DB: db, Logger: logger, HistoryTable: historyTable}
+		if err := dl.EnsureHistoryTable(ctx); err != nil {
+			level.Warn(logger).Log("msg", "failed to create load history table", "history_table", historyTable, "err", err)
+		}
+		cancel()
 	}
 
+	flushSpans := setupTracing(os.Getenv("TRACE_EXPORTER"))
+
 	// Start up lambda handler
 	lambda.Start(func(ctx context.Context, event events.S3Event) (*Response, error) {
 		lc, _ := lambdacontext.FromContext(ctx)
+		// Continue the trace lambda started the invocation in, X-Ray passes it along outside the event
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier{"X-Amzn-Trace-Id": os.Getenv("_X_AMZN_TRACE_ID")})
+		defer func() {
+			if err := flushSpans(ctx); err != nil {
+				level.Warn(logger).Log("msg", "failed to flush spans", "err", err)
+			}
+		}()
 		h := handler{
 			dl: &dataloader.DataLoader{
 				Env:          env,
@@ -87,8 +116,131 @@ func main() {
 				Logger:       log.With(logger, "request_id", lc.AwsRequestID),
 				SchemaBucket: schemaBucket,
 				S3Svc:        s3Svc,
+				Target:       dbTarget,
+				HistoryTable: historyTable,
+				// CloudWatch extracts metrics from the embedded metric format documents in the function's logs
+				Metrics: os.Stdout,
 			},
 		}
 		return h.handle(ctx, event)
 	})
 }
+
+// Sets up the global tracer provider exporting spans the way exporter names and returns a function flushing spans not
+// exported yet, which has to run before each invocation returns since lambda freezes the function afterwards. Spans go
+// nowhere unless exporter is otlp, to the collector at OTEL_EXPORTER_OTLP_ENDPOINT, or xray, to the collector of the
+// AWS Distro for OpenTelemetry layer with X-Ray trace IDs.
+func setupTracing(exporter string) func(context.Context) error {
+	var options []sdktrace.TracerProviderOption
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }
+	case "otlp":
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	case "xray":
+		options = append(options, sdktrace.WithIDGenerator(xray.NewIDGenerator()))
+		otel.SetTextMapPropagator(xray.Propagator{})
+	default:
+		panic(fmt.Sprintf("unknown TRACE_EXPORTER %s", exporter))
+	}
+	spanExporter, err := otlptracegrpc.New(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	provider := sdktrace.NewTracerProvider(append(options, sdktrace.WithBatcher(spanExporter))...)
+	otel.SetTracerProvider(provider)
+	return provider.ForceFlush
+}
+
+// Opens a connection pool to the cluster, with credentials from the provider DB_AUTH selects.
+func openDatabase(sess *session.Session, ssmSvc *ssm.SSM, env, dbName string) *sql.DB {
+	dbAuth := os.Getenv("DB_AUTH")
+
+	// Pick where connections get their credentials, the master password in SSM unless configured otherwise
+	var (
+		credentials dbconn.CredentialProvider
+		endpoint    string
+	)
+	switch dbAuth {
+	case "", "ssm", "password":
+		credentials = &dbconn.SSMCredentials{
+			Svc:               ssmSvc,
+			User:              "admin",
+			PasswordParameter: fmt.Sprintf("/data-loader/%s/master-password", env),
+		}
+	case "iam":
+		if os.Getenv("CLUSTER_IDENTIFIER") == "" || os.Getenv("DB_USER") == "" {
+			panic("CLUSTER_IDENTIFIER and DB_USER must be defined for DB_AUTH iam")
+		}
+		// Optionally create the user on its first login and join it to database groups for the session
+		autoCreate := false
+		if v := os.Getenv("DB_AUTO_CREATE"); v != "" {
+			var err error
+			if autoCreate, err = strconv.ParseBool(v); err != nil {
+				panic(fmt.Sprintf("invalid DB_AUTO_CREATE %s", v))
+			}
+		}
+		var dbGroups []string
+		for _, group := range strings.Split(os.Getenv("DB_GROUPS"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				dbGroups = append(dbGroups, group)
+			}
+		}
+		credentials = &dbconn.ClusterCredentials{
+			Svc:               redshift.New(sess),
+			ClusterIdentifier: os.Getenv("CLUSTER_IDENTIFIER"),
+			DBUser:            os.Getenv("DB_USER"),
+			DBName:            dbName,
+			AutoCreate:        autoCreate,
+			DBGroups:          dbGroups,
+		}
+	case "secretsmanager":
+		if os.Getenv("DB_SECRET_ID") == "" {
+			panic("DB_SECRET_ID must be defined for DB_AUTH secretsmanager")
+		}
+		credentials = &dbconn.SecretsManagerCredentials{
+			Svc:      secretsmanager.New(sess),
+			SecretID: os.Getenv("DB_SECRET_ID"),
+		}
+	case "env":
+		credentials = dbconn.EnvCredentials{}
+		endpoint = os.Getenv("DB_HOST")
+	case "file":
+		if os.Getenv("DB_CREDENTIALS_FILE") == "" {
+			panic("DB_CREDENTIALS_FILE must be defined for DB_AUTH file")
+		}
+		credentials = &dbconn.FileCredentials{Path: os.Getenv("DB_CREDENTIALS_FILE")}
+	default:
+		panic(fmt.Sprintf("unknown DB_AUTH %s", dbAuth))
+	}
+
+	// Fetch cluster endpoint from SSM, unless it came with the credentials
+	lookupEndpoint := func(ctx context.Context) (string, error) {
+		endpointRsp, err := ssmSvc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+			Name:           aws.String(fmt.Sprintf("/data-loader/%s/cluster-endpoint", env)),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(endpointRsp.Parameter.Value), nil
+	}
+	connector := &dbconn.Connector{
+		Host:     endpoint,
+		Port:     5439,
+		DBName:   dbName,
+		Provider: credentials,
+	}
+	if endpoint == "" && (dbAuth == "secretsmanager" || dbAuth == "file") {
+		// Secrets may or may not hold the endpoint, only look it up for the ones that don't
+		connector.LookupHost = lookupEndpoint
+	} else if endpoint == "" {
+		var err error
+		if connector.Host, err = lookupEndpoint(context.Background()); err != nil {
+			panic(err)
+		}
+	}
+
+	// Establish DB connection, logging each new connection in with current credentials
+	return sql.OpenDB(connector)
+}
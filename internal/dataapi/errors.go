@@ -0,0 +1,71 @@
+package dataapi
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+	"github.com/lib/pq"
+)
+
+// StatementError is a statement the Data API reports as failed or aborted. It unwraps to a *pq.Error with the
+// statement's SQLSTATE, so the loader classifies it the same way as an error from a connection.
+type StatementError struct {
+	ID      string
+	Status  types.StatusString
+	Message string
+}
+
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("statement %s %s: %s", e.ID, strings.ToLower(string(e.Status)), e.Message)
+}
+
+// Unwrap returns the statement's error as a *pq.Error, nil when its SQLSTATE can't be told.
+func (e *StatementError) Unwrap() error {
+	code := e.Code()
+	if code == "" {
+		return nil
+	}
+	return &pq.Error{Severity: "ERROR", Code: code, Message: e.Message}
+}
+
+// SQLSTATE of the error text when Redshift includes one.
+var sqlStatePattern = regexp.MustCompile(`SQLSTATE[:= ]*\(?([0-9A-Z]{5})\)?`)
+
+// SQLSTATEs of the errors the loader runs into, by the lowercased text Redshift reports them with. The Data API only
+// returns the text, and usually without the code. Checked in order, the first match wins. Other missing objects, e.g.
+// a role or user, are left unclassified rather than taken for a missing table.
+var messageCodes = []struct {
+	pattern *regexp.Regexp
+	code    pq.ErrorCode
+}{
+	{regexp.MustCompile(`serializable isolation violation`), "40001"},
+	{regexp.MustCompile(`password authentication failed`), "28P01"},
+	{regexp.MustCompile(`permission denied`), "42501"},
+	{regexp.MustCompile(`database ".*" does not exist`), "3D000"},
+	{regexp.MustCompile(`already exists`), "42P07"},
+	{regexp.MustCompile(`duplicate key`), "23505"},
+	{regexp.MustCompile(`relation ".*" does not exist`), "42P01"},
+	{regexp.MustCompile(`invalid input syntax`), "22P02"},
+	{regexp.MustCompile(`value too long`), "22001"},
+	{regexp.MustCompile(`stl_load_errors`), "XX000"}, // COPY rejecting rows
+}
+
+// Code returns the SQLSTATE of the statement's error, parsed from its text or inferred from the message, empty when
+// neither tells. An aborted statement was cancelled, which is query_canceled.
+func (e *StatementError) Code() pq.ErrorCode {
+	if e.Status == types.StatusStringAborted {
+		return "57014"
+	}
+	if m := sqlStatePattern.FindStringSubmatch(e.Message); m != nil {
+		return pq.ErrorCode(m[1])
+	}
+	message := strings.ToLower(e.Message)
+	for _, mc := range messageCodes {
+		if mc.pattern.MatchString(message) {
+			return mc.code
+		}
+	}
+	return ""
+}
@@ -0,0 +1,43 @@
+package dataapi
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+	"github.com/lib/pq"
+)
+
+func TestStatementErrorCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  types.StatusString
+		message string
+		want    pq.ErrorCode
+	}{
+		{name: "sqlstate", status: types.StatusStringFailed, message: "ERROR: syntax error at or near \"x\" (SQLSTATE 42601)", want: "42601"},
+		{name: "aborted", status: types.StatusStringAborted, message: "Query (123) cancelled on user's request", want: "57014"},
+		{name: "serializable", status: types.StatusStringFailed, message: "ERROR: 1023 DETAIL: Serializable isolation violation on table - 123", want: "40001"},
+		{name: "table-exists", status: types.StatusStringFailed, message: "ERROR: Relation \"t\" already exists", want: "42P07"},
+		{name: "duplicate-key", status: types.StatusStringFailed, message: "ERROR: duplicate key violates unique constraint \"pg_type_typname_nsp_index\"", want: "23505"},
+		{name: "missing-table", status: types.StatusStringFailed, message: "ERROR: relation \"t\" does not exist", want: "42P01"},
+		{name: "missing-role", status: types.StatusStringFailed, message: "ERROR: role \"loader\" does not exist"},
+		{name: "missing-user", status: types.StatusStringFailed, message: "ERROR: user \"loader\" does not exist"},
+		{name: "missing-database", status: types.StatusStringFailed, message: "FATAL: database \"dev\" does not exist", want: "3D000"},
+		{name: "privilege", status: types.StatusStringFailed, message: "ERROR: permission denied for schema raw", want: "42501"},
+		{name: "load-errors", status: types.StatusStringFailed, message: "ERROR: Load into table 't' failed. Check 'stl_load_errors' system table for details.", want: "XX000"},
+		{name: "unknown", status: types.StatusStringFailed, message: "ERROR: something else"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &StatementError{ID: "stmt-1", Status: tt.status, Message: tt.message}
+			var pqErr *pq.Error
+			if found := errors.As(err, &pqErr); found != (tt.want != "") {
+				t.Fatalf("want a *pq.Error: %v, got: %v", tt.want != "", found)
+			}
+			if pqErr != nil && (pqErr.Code != tt.want || pqErr.Message != tt.message) {
+				t.Errorf("want: %s, got: %s %s", tt.want, pqErr.Code, pqErr.Message)
+			}
+		})
+	}
+}
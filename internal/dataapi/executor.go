@@ -0,0 +1,308 @@
+// Package dataapi runs the loader's SQL through the Redshift Data API, so the loader needs neither network access to
+// the cluster nor a connection held open for the length of a COPY.
+package dataapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+	"github.com/ellery44/data-loader/internal/dataloader"
+)
+
+// Defaults for the zero values of Executor's tuning fields.
+const (
+	defaultPollInterval     = 250 * time.Millisecond
+	defaultMaxPollInterval  = 5 * time.Second
+	defaultSessionKeepAlive = 10 * time.Minute
+)
+
+// API is the part of the Redshift Data API client the executor uses, implemented by *redshiftdata.Client. Sessions
+// are only supported by aws-sdk-go-v2, the v1 SDK has no way to run a transaction across statements.
+type API interface {
+	ExecuteStatement(ctx context.Context, params *redshiftdata.ExecuteStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.ExecuteStatementOutput, error)
+	DescribeStatement(ctx context.Context, params *redshiftdata.DescribeStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.DescribeStatementOutput, error)
+	GetStatementResult(ctx context.Context, params *redshiftdata.GetStatementResultInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.GetStatementResultOutput, error)
+	CancelStatement(ctx context.Context, params *redshiftdata.CancelStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.CancelStatementOutput, error)
+}
+
+// Executor is a dataloader.Executor submitting statements with ExecuteStatement and polling DescribeStatement until
+// they finish. Transactions run in a Data API session kept alive between their statements, so session state such as
+// temporary tables and pg_last_copy_count() behaves as it would on a connection.
+type Executor struct {
+	Svc API
+
+	// Provisioned cluster or serverless workgroup to run statements on, and the database to run them in.
+	ClusterIdentifier string
+	WorkgroupName     string
+	Database          string
+	// Authenticate as DBUser with temporary IAM credentials, or with the Secrets Manager secret SecretArn.
+	DBUser    string
+	SecretArn string
+
+	// How long to wait between polls of a running statement, doubling up to MaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+	// How long the session of a transaction is kept open waiting for its next statement.
+	SessionKeepAlive time.Duration
+}
+
+// BeginTx implements dataloader.Executor.
+func (e *Executor) BeginTx(ctx context.Context) (dataloader.Tx, error) {
+	keepAlive := e.SessionKeepAlive
+	if keepAlive == 0 {
+		keepAlive = defaultSessionKeepAlive
+	}
+	input := e.statementInput("", "BEGIN;")
+	input.SessionKeepAliveSeconds = aws.Int32(int32(keepAlive / time.Second))
+	stmt, err := e.submit(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.SessionId == nil {
+		return nil, fmt.Errorf("data api started no session for the transaction")
+	}
+	return &tx{e: e, sessionID: aws.ToString(stmt.SessionId)}, nil
+}
+
+// ExecContext implements dataloader.Queryer.
+func (e *Executor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return e.exec(ctx, "", query, args)
+}
+
+// QueryContext implements dataloader.Queryer.
+func (e *Executor) QueryContext(ctx context.Context, query string, args ...interface{}) (dataloader.Rows, error) {
+	return e.query(ctx, "", query, args)
+}
+
+// QueryRowContext implements dataloader.Queryer.
+func (e *Executor) QueryRowContext(ctx context.Context, query string, args ...interface{}) dataloader.Row {
+	rows, err := e.query(ctx, "", query, args)
+	return &row{rows: rows, err: err}
+}
+
+func (e *Executor) exec(ctx context.Context, sessionID, query string, args []interface{}) (sql.Result, error) {
+	stmt, err := e.run(ctx, sessionID, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return result(stmt.ResultRows), nil
+}
+
+func (e *Executor) query(ctx context.Context, sessionID, query string, args []interface{}) (*rows, error) {
+	stmt, err := e.run(ctx, sessionID, query, args)
+	if err != nil {
+		return nil, err
+	}
+	r := &rows{}
+	if !aws.ToBool(stmt.HasResultSet) {
+		return r, nil
+	}
+	input := &redshiftdata.GetStatementResultInput{Id: stmt.Id}
+	for {
+		page, err := e.Svc.GetStatementResult(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		r.records = append(r.records, page.Records...)
+		if aws.ToString(page.NextToken) == "" {
+			return r, nil
+		}
+		input.NextToken = page.NextToken
+	}
+}
+
+// Runs a statement, in the passed session if there is one, and waits for it to finish.
+func (e *Executor) run(ctx context.Context, sessionID, query string, args []interface{}) (*redshiftdata.DescribeStatementOutput, error) {
+	sqlText, err := bindArgs(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return e.submit(ctx, e.statementInput(sessionID, sqlText))
+}
+
+// Builds the ExecuteStatement input for sqlText. Statements in a session only name the session, others name where
+// and as whom to run.
+func (e *Executor) statementInput(sessionID, sqlText string) *redshiftdata.ExecuteStatementInput {
+	input := &redshiftdata.ExecuteStatementInput{Sql: aws.String(sqlText)}
+	if sessionID != "" {
+		input.SessionId = aws.String(sessionID)
+		return input
+	}
+	input.Database = aws.String(e.Database)
+	if e.ClusterIdentifier != "" {
+		input.ClusterIdentifier = aws.String(e.ClusterIdentifier)
+	}
+	if e.WorkgroupName != "" {
+		input.WorkgroupName = aws.String(e.WorkgroupName)
+	}
+	if e.DBUser != "" {
+		input.DbUser = aws.String(e.DBUser)
+	}
+	if e.SecretArn != "" {
+		input.SecretArn = aws.String(e.SecretArn)
+	}
+	return input
+}
+
+// Submits a statement and waits for it to finish.
+func (e *Executor) submit(ctx context.Context, input *redshiftdata.ExecuteStatementInput) (*redshiftdata.DescribeStatementOutput, error) {
+	rsp, err := e.Svc.ExecuteStatement(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := e.wait(ctx, aws.ToString(rsp.Id))
+	if err != nil {
+		return nil, err
+	}
+	if stmt.SessionId == nil {
+		stmt.SessionId = rsp.SessionId
+	}
+	return stmt, nil
+}
+
+// Polls the statement with passed ID until it is done, cancelling it if ctx is done first.
+func (e *Executor) wait(ctx context.Context, id string) (*redshiftdata.DescribeStatementOutput, error) {
+	interval, maxInterval := e.PollInterval, e.MaxPollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	if maxInterval == 0 {
+		maxInterval = defaultMaxPollInterval
+	}
+	for {
+		stmt, err := e.Svc.DescribeStatement(ctx, &redshiftdata.DescribeStatementInput{Id: aws.String(id)})
+		if err != nil {
+			return nil, err
+		}
+		switch stmt.Status {
+		case types.StatusStringFinished:
+			return stmt, nil
+		case types.StatusStringFailed, types.StatusStringAborted:
+			return nil, &StatementError{ID: id, Status: stmt.Status, Message: aws.ToString(stmt.Error)}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			// The statement keeps running server side unless told otherwise, ctx is already done so don't use it
+			e.Svc.CancelStatement(context.Background(), &redshiftdata.CancelStatementInput{Id: aws.String(id)})
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// tx is a transaction running in a Data API session.
+type tx struct {
+	e         *Executor
+	sessionID string
+	done      bool
+}
+
+func (t *tx) Commit() error {
+	return t.finish("COMMIT;")
+}
+
+func (t *tx) Rollback() error {
+	return t.finish("ROLLBACK;")
+}
+
+func (t *tx) finish(query string) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.e.run(context.Background(), t.sessionID, query, nil)
+	return err
+}
+
+func (t *tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if t.done {
+		return nil, sql.ErrTxDone
+	}
+	return t.e.exec(ctx, t.sessionID, query, args)
+}
+
+func (t *tx) QueryContext(ctx context.Context, query string, args ...interface{}) (dataloader.Rows, error) {
+	if t.done {
+		return nil, sql.ErrTxDone
+	}
+	return t.e.query(ctx, t.sessionID, query, args)
+}
+
+func (t *tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) dataloader.Row {
+	if t.done {
+		return &row{err: sql.ErrTxDone}
+	}
+	rows, err := t.e.query(ctx, t.sessionID, query, args)
+	return &row{rows: rows, err: err}
+}
+
+// result reports the rows a statement affected. The Data API has no notion of last insert IDs.
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, fmt.Errorf("LastInsertId is not supported by the data api")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+// Matches the $1, $2, ... placeholders of a statement.
+var placeholderPattern = regexp.MustCompile(`\$([0-9]+)`)
+
+// Renders args into the placeholders of query as literals. Data API parameters can't be empty strings, which the
+// loader's queries rely on, so the arguments are inlined instead.
+func bindArgs(query string, args []interface{}) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	var err error
+	bound := placeholderPattern.ReplaceAllStringFunc(query, func(placeholder string) string {
+		n, _ := strconv.Atoi(placeholder[1:])
+		if n < 1 || n > len(args) {
+			err = fmt.Errorf("no argument for placeholder %s", placeholder)
+			return placeholder
+		}
+		literal, litErr := literalValue(args[n-1])
+		if litErr != nil {
+			err = litErr
+		}
+		return literal
+	})
+	return bound, err
+}
+
+// Renders an argument as a SQL literal.
+func literalValue(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		v = strings.Replace(v, `\`, `\\`, -1)
+		return "'" + strings.Replace(v, "'", "''", -1) + "'", nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'", nil
+	default:
+		return "", fmt.Errorf("unsupported argument type %T", arg)
+	}
+}
@@ -0,0 +1,221 @@
+package dataapi
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+)
+
+// mockDataAPI finishes every statement after a number of polls, failing those whose SQL is in failures and
+// answering those in results.
+type mockDataAPI struct {
+	polls     int
+	failures  map[string]string
+	results   map[string][][]types.Field
+	inputs    []*redshiftdata.ExecuteStatementInput
+	sqls      map[string]string
+	described map[string]int
+	cancelled []string
+}
+
+func (m *mockDataAPI) ExecuteStatement(ctx context.Context, input *redshiftdata.ExecuteStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.ExecuteStatementOutput, error) {
+	m.inputs = append(m.inputs, input)
+	id := fmt.Sprintf("stmt-%d", len(m.inputs))
+	if m.sqls == nil {
+		m.sqls, m.described = make(map[string]string), make(map[string]int)
+	}
+	m.sqls[id] = aws.ToString(input.Sql)
+	out := &redshiftdata.ExecuteStatementOutput{Id: aws.String(id), SessionId: input.SessionId}
+	if input.SessionKeepAliveSeconds != nil {
+		out.SessionId = aws.String("session-1")
+	}
+	return out, nil
+}
+
+func (m *mockDataAPI) DescribeStatement(ctx context.Context, input *redshiftdata.DescribeStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.DescribeStatementOutput, error) {
+	id := aws.ToString(input.Id)
+	m.described[id]++
+	out := &redshiftdata.DescribeStatementOutput{Id: input.Id, Status: types.StatusStringStarted}
+	if m.described[id] <= m.polls {
+		return out, nil
+	}
+	sqlText := m.sqls[id]
+	if msg, ok := m.failures[sqlText]; ok {
+		out.Status, out.Error = types.StatusStringFailed, aws.String(msg)
+		return out, nil
+	}
+	out.Status = types.StatusStringFinished
+	if records, ok := m.results[sqlText]; ok {
+		out.HasResultSet, out.ResultRows = aws.Bool(true), int64(len(records))
+	} else {
+		out.ResultRows = 3
+	}
+	return out, nil
+}
+
+func (m *mockDataAPI) GetStatementResult(ctx context.Context, input *redshiftdata.GetStatementResultInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.GetStatementResultOutput, error) {
+	records := m.results[m.sqls[aws.ToString(input.Id)]]
+	// Serve one record per page to exercise paging
+	start := 0
+	if input.NextToken != nil {
+		fmt.Sscanf(aws.ToString(input.NextToken), "%d", &start)
+	}
+	out := &redshiftdata.GetStatementResultOutput{}
+	if start < len(records) {
+		out.Records = records[start : start+1]
+	}
+	if start+1 < len(records) {
+		out.NextToken = aws.String(fmt.Sprint(start + 1))
+	}
+	return out, nil
+}
+
+func (m *mockDataAPI) CancelStatement(ctx context.Context, input *redshiftdata.CancelStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.CancelStatementOutput, error) {
+	m.cancelled = append(m.cancelled, aws.ToString(input.Id))
+	return &redshiftdata.CancelStatementOutput{Status: aws.Bool(true)}, nil
+}
+
+func TestExecutorTransaction(t *testing.T) {
+	svc := &mockDataAPI{
+		polls: 2,
+		results: map[string][][]types.Field{
+			"SELECT pg_last_copy_count();": {{&types.FieldMemberLongValue{Value: 3}}},
+			"SELECT TABLE_SCHEMA, COLUMN_NAME, CHARACTER_MAXIMUM_LENGTH FROM T WHERE TABLE_SCHEMA = '' AND TABLE_NAME = 'it''s';": {
+				{&types.FieldMemberStringValue{Value: "public"}, &types.FieldMemberStringValue{Value: "name"}, &types.FieldMemberLongValue{Value: 10}},
+				{&types.FieldMemberStringValue{Value: "public"}, &types.FieldMemberStringValue{Value: "count"}, &types.FieldMemberIsNull{Value: true}},
+			},
+		},
+	}
+	e := &Executor{
+		Svc:               svc,
+		ClusterIdentifier: "data-loader-dev",
+		Database:          "data-loader-dev",
+		DBUser:            "data_loader",
+		PollInterval:      time.Millisecond,
+	}
+	ctx := context.Background()
+
+	tx, err := e.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := tx.ExecContext(ctx, "COPY t FROM 's3://bucket/key';")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if affected, _ := res.RowsAffected(); affected != 3 {
+		t.Errorf("want 3 rows affected, got %d", affected)
+	}
+	var loaded int64
+	if err := tx.QueryRowContext(ctx, "SELECT pg_last_copy_count();").Scan(&loaded); err != nil || loaded != 3 {
+		t.Errorf("want 3 rows loaded, got %d, %v", loaded, err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT TABLE_SCHEMA, COLUMN_NAME, CHARACTER_MAXIMUM_LENGTH FROM T WHERE TABLE_SCHEMA = $1 AND TABLE_NAME = $2;", "", "it's")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for rows.Next() {
+		var schema, name string
+		var length sql.NullInt64
+		if err := rows.Scan(&schema, &name, &length); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s.%s(%d,%t)", schema, name, length.Int64, length.Valid))
+	}
+	rows.Close()
+	if want := []string{"public.name(10,true)", "public.count(0,false)"}; !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v, got: %v", want, got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Rollback(); err != sql.ErrTxDone {
+		t.Errorf("want: %v, got: %v", sql.ErrTxDone, err)
+	}
+
+	// Only the BEGIN names the target, the rest run in its session
+	begin := svc.inputs[0]
+	if aws.ToString(begin.ClusterIdentifier) != "data-loader-dev" || aws.ToString(begin.DbUser) != "data_loader" ||
+		aws.ToInt32(begin.SessionKeepAliveSeconds) != 600 {
+		t.Errorf("unexpected BEGIN input: %+v", begin)
+	}
+	for _, input := range svc.inputs[1:] {
+		if aws.ToString(input.SessionId) != "session-1" || input.ClusterIdentifier != nil {
+			t.Errorf("want statement in session-1, got: %+v", input)
+		}
+	}
+	if last := aws.ToString(svc.inputs[len(svc.inputs)-1].Sql); last != "COMMIT;" {
+		t.Errorf("want COMMIT last, got: %s", last)
+	}
+}
+
+func TestExecutorFailedStatement(t *testing.T) {
+	svc := &mockDataAPI{failures: map[string]string{"COPY t;": "Load into table 't' failed."}}
+	e := &Executor{Svc: svc, WorkgroupName: "loader", Database: "dev", PollInterval: time.Millisecond}
+	_, err := e.ExecContext(context.Background(), "COPY t;")
+	if want := "statement stmt-1 failed: Load into table 't' failed."; err == nil || err.Error() != want {
+		t.Errorf("want: %s, got: %v", want, err)
+	}
+	if aws.ToString(svc.inputs[0].WorkgroupName) != "loader" || svc.inputs[0].SessionKeepAliveSeconds != nil {
+		t.Errorf("unexpected input: %+v", svc.inputs[0])
+	}
+}
+
+func TestExecutorCancelledWhilePolling(t *testing.T) {
+	svc := &mockDataAPI{polls: 1000}
+	e := &Executor{Svc: svc, Database: "dev", PollInterval: time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := e.ExecContext(ctx, "COPY t;")
+	if err != context.DeadlineExceeded {
+		t.Errorf("want: %v, got: %v", context.DeadlineExceeded, err)
+	}
+	if !reflect.DeepEqual([]string{"stmt-1"}, svc.cancelled) {
+		t.Errorf("want stmt-1 cancelled, got: %v", svc.cancelled)
+	}
+}
+
+var _ API = (*redshiftdata.Client)(nil)
+
+func TestBindArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  string
+		err   error
+	}{
+		{name: "no-args", query: "SELECT 1;", want: "SELECT 1;"},
+		{
+			name:  "literals",
+			query: "SELECT $1, $2, $3, $4, $1;",
+			args:  []interface{}{`a'b\c`, int64(7), nil, true},
+			want:  `SELECT 'a''b\\c', 7, NULL, true, 'a''b\\c';`,
+		},
+		{name: "missing", query: "SELECT $2;", args: []interface{}{"a"}, err: errors.New("no argument for placeholder $2")},
+		{name: "unsupported", query: "SELECT $1;", args: []interface{}{1.5}, err: errors.New("unsupported argument type float64")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := bindArgs(tt.query, tt.args)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if err == nil && tt.want != got {
+				t.Errorf("want: %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package dataapi
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+)
+
+// rows is a fully fetched statement result, read the same way as *sql.Rows.
+type rows struct {
+	records [][]types.Field
+	pos     int
+}
+
+func (r *rows) Next() bool {
+	if r.pos >= len(r.records) {
+		return false
+	}
+	r.pos++
+	return true
+}
+
+func (r *rows) Scan(dest ...interface{}) error {
+	if r.pos == 0 || r.pos > len(r.records) {
+		return fmt.Errorf("scan called without calling next")
+	}
+	record := r.records[r.pos-1]
+	if len(dest) != len(record) {
+		return fmt.Errorf("expected %d destination arguments in scan, not %d", len(record), len(dest))
+	}
+	for i, field := range record {
+		if err := assign(dest[i], fieldValue(field)); err != nil {
+			return fmt.Errorf("scanning column %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (r *rows) Err() error {
+	return nil
+}
+
+func (r *rows) Close() error {
+	r.pos = len(r.records)
+	return nil
+}
+
+// row is the first row of a statement result, read the same way as *sql.Row.
+type row struct {
+	rows *rows
+	err  error
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		return sql.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+// Returns the Go value of a result field, nil for NULL.
+func fieldValue(f types.Field) interface{} {
+	switch v := f.(type) {
+	case *types.FieldMemberStringValue:
+		return v.Value
+	case *types.FieldMemberLongValue:
+		return v.Value
+	case *types.FieldMemberDoubleValue:
+		return v.Value
+	case *types.FieldMemberBooleanValue:
+		return v.Value
+	case *types.FieldMemberBlobValue:
+		return v.Value
+	}
+	// NULL, or a kind of field this version of the SDK doesn't know
+	return nil
+}
+
+// Stores a field value into a Scan destination, converting between the types the loader reads results into.
+func assign(dest, value interface{}) error {
+	if scanner, ok := dest.(sql.Scanner); ok {
+		return scanner.Scan(value)
+	}
+	if value == nil {
+		if d, ok := dest.(*interface{}); ok {
+			*d = nil
+			return nil
+		}
+		return fmt.Errorf("converting NULL to %T is unsupported", dest)
+	}
+	switch d := dest.(type) {
+	case *interface{}:
+		*d = value
+	case *string:
+		*d = fmt.Sprint(value)
+	case *bool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("converting %T to bool is unsupported", value)
+		}
+		*d = v
+	case *int64, *int:
+		var n int64
+		switch v := value.(type) {
+		case int64:
+			n = v
+		case string:
+			var err error
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("converting %T to an integer is unsupported", value)
+		}
+		if p, ok := d.(*int); ok {
+			*p = int(n)
+		} else {
+			*d.(*int64) = n
+		}
+	case *float64:
+		switch v := value.(type) {
+		case float64:
+			*d = v
+		case int64:
+			*d = float64(v)
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return err
+			}
+			*d = f
+		default:
+			return fmt.Errorf("converting %T to float64 is unsupported", value)
+		}
+	default:
+		return fmt.Errorf("unsupported scan destination %T", dest)
+	}
+	return nil
+}
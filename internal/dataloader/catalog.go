@@ -0,0 +1,160 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tableInfo is what the redshift catalog knows about an existing table.
+type tableInfo struct {
+	Schema  string
+	Name    string
+	Columns []columnInfo
+}
+
+// columnInfo describes one column of an existing table, as reported by INFORMATION_SCHEMA.COLUMNS.
+type columnInfo struct {
+	Name string
+	// Redshift type name, e.g. character varying, numeric or integer.
+	DataType string
+	// Declared length of character columns, 0 for other types.
+	CharacterMaxLength int
+	// Declared precision and scale of numeric columns, 0 for other types.
+	NumericPrecision int
+	NumericScale     int
+	Nullable         bool
+}
+
+// Looks up passed table in the catalog, in the current schema when none is passed, and returns its columns in order.
+// Returns nil if the table doesn't exist. Names are matched lowercased, the way redshift stores unquoted identifiers.
+func (d *DataLoader) lookupTable(ctx context.Context, tx Tx, schemaName, tableName string) (*tableInfo, error) {
+	const tableColumnsQuery = `SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, ` +
+		`NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS ` +
+		`WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), CURRENT_SCHEMA()) AND TABLE_NAME = $2 ORDER BY ORDINAL_POSITION;`
+	rows, err := tx.QueryContext(ctx, tableColumnsQuery, strings.ToLower(schemaName), strings.ToLower(tableName))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var info *tableInfo
+	for rows.Next() {
+		var (
+			schema, nullable            string
+			col                         columnInfo
+			maxLength, precision, scale sql.NullInt64
+		)
+		err = rows.Scan(&schema, &col.Name, &col.DataType, &maxLength, &precision, &scale, &nullable)
+		if err != nil {
+			return nil, err
+		}
+		col.CharacterMaxLength = int(maxLength.Int64)
+		col.NumericPrecision = int(precision.Int64)
+		col.NumericScale = int(scale.Int64)
+		col.Nullable = nullable == "YES"
+		if info == nil {
+			info = &tableInfo{Schema: schema, Name: strings.ToLower(tableName)}
+		}
+		info.Columns = append(info.Columns, col)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Catalog names of the types the loader creates columns with, as INFORMATION_SCHEMA.COLUMNS reports them.
+var catalogTypes = map[string]string{
+	"TEXT":      "character varying",
+	"VARCHAR":   "character varying",
+	"CHAR":      "character",
+	"DECIMAL":   "numeric",
+	"INTEGER":   "integer",
+	"BOOLEAN":   "boolean",
+	"DATE":      "date",
+	"TIMESTAMP": "timestamp without time zone",
+}
+
+// expectedColumn is a column a layout loads into, with its catalog type and the smallest size that holds its values.
+type expectedColumn struct {
+	Name     string
+	DataType string
+	// Characters of character columns.
+	Length int
+	// Precision and scale of numeric columns.
+	Precision int
+	Scale     int
+}
+
+// Lists the columns the loader creates for passed layout, in order. Schemas are validated when loaded, so the widths
+// and transforms of its columns are known to be valid.
+func expectedColumns(layout tableLayout) []expectedColumn {
+	columns := make([]expectedColumn, 0, len(layout.Columns)+len(layout.Metadata))
+	for _, col := range layout.Columns {
+		valueType, _ := validateTransforms(col)
+		c := expectedColumn{Name: strings.ToLower(col.Name), DataType: catalogTypes[valueType]}
+		width, _ := strconv.Atoi(col.Width)
+		switch valueType {
+		case "TEXT":
+			c.Length = width
+		case "DECIMAL":
+			c.Precision, c.Scale = decimalPrecision(width, col.Sign), col.Scale
+		}
+		columns = append(columns, c)
+	}
+	for _, name := range layout.Metadata {
+		// Metadata column types are a type name with an optional length, e.g. VARCHAR(1024)
+		dataType, length := metadataColumnTypes[name], 0
+		if i := strings.Index(dataType, "("); i >= 0 {
+			length, _ = strconv.Atoi(strings.TrimSuffix(dataType[i+1:], ")"))
+			dataType = dataType[:i]
+		}
+		columns = append(columns, expectedColumn{Name: name, DataType: catalogTypes[dataType], Length: length})
+	}
+	return columns
+}
+
+// Checks an existing table still has the columns passed layout loads into, returning a SchemaError listing every
+// difference otherwise. The table drifted from its schema if it lost, gained or reordered columns, changed the type
+// of one or narrowed it below what the schema declares. Wider columns are fine, e.g. VARCHARs sized for transcoded
+// text.
+func checkSchemaDrift(layout tableLayout, info *tableInfo) error {
+	want := expectedColumns(layout)
+	var drift []string
+	for i := 0; i < len(want) || i < len(info.Columns); i++ {
+		switch {
+		case i >= len(info.Columns):
+			drift = append(drift, fmt.Sprintf("column %s is missing", want[i].Name))
+		case i >= len(want):
+			drift = append(drift, fmt.Sprintf("column %s is not in the schema", info.Columns[i].Name))
+		default:
+			if d := want[i].driftFrom(i, info.Columns[i]); d != "" {
+				drift = append(drift, d)
+			}
+		}
+	}
+	if len(drift) == 0 {
+		return nil
+	}
+	return &SchemaError{fmt.Errorf("table %s drifted from its schema: %s", layout.qualifiedTable(),
+		strings.Join(drift, ", "))}
+}
+
+// Describes how col, the table's column at position i, differs from c. Returns "" if col holds c's values.
+func (c expectedColumn) driftFrom(i int, col columnInfo) string {
+	switch {
+	case col.Name != c.Name:
+		return fmt.Sprintf("column %d is %s, not %s", i+1, col.Name, c.Name)
+	case col.DataType != c.DataType:
+		return fmt.Sprintf("column %s is %s, not %s", c.Name, col.DataType, c.DataType)
+	case col.CharacterMaxLength < c.Length:
+		return fmt.Sprintf("column %s holds %d characters, not %d", c.Name, col.CharacterMaxLength, c.Length)
+	case c.DataType == "numeric" && (col.NumericPrecision < c.Precision || col.NumericScale != c.Scale):
+		return fmt.Sprintf("column %s is numeric(%d,%d), not numeric(%d,%d)", c.Name,
+			col.NumericPrecision, col.NumericScale, c.Precision, c.Scale)
+	}
+	return ""
+}
@@ -0,0 +1,286 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-kit/kit/log"
+)
+
+var tableColumnsQuery = regexp.QuoteMeta("SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, " +
+	"NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS")
+
+func TestLookupTable(t *testing.T) {
+	columns := []string{"table_schema", "column_name", "data_type", "character_maximum_length", "numeric_precision",
+		"numeric_scale", "is_nullable"}
+	tests := []struct {
+		name     string
+		schema   string
+		table    string
+		wantArgs []string
+		rows     *sqlmock.Rows
+		queryErr error
+		want     *tableInfo
+		err      error
+	}{
+		{
+			name:     "happy-path",
+			schema:   "Raw_Vendor_X",
+			table:    "TestTable",
+			wantArgs: []string{"raw_vendor_x", "testtable"},
+			rows: sqlmock.NewRows(columns).
+				AddRow("raw_vendor_x", "name", "character varying", 10, nil, nil, "YES").
+				AddRow("raw_vendor_x", "amount", "numeric", nil, 7, 2, "NO"),
+			want: &tableInfo{
+				Schema: "raw_vendor_x",
+				Name:   "testtable",
+				Columns: []columnInfo{
+					{Name: "name", DataType: "character varying", CharacterMaxLength: 10, Nullable: true},
+					{Name: "amount", DataType: "numeric", NumericPrecision: 7, NumericScale: 2},
+				},
+			},
+		},
+		{
+			name:     "current-schema",
+			table:    "testtable",
+			wantArgs: []string{"", "testtable"},
+			rows:     sqlmock.NewRows(columns).AddRow("public", "count", "integer", nil, 32, 0, "YES"),
+			want: &tableInfo{
+				Schema:  "public",
+				Name:    "testtable",
+				Columns: []columnInfo{{Name: "count", DataType: "integer", NumericPrecision: 32, Nullable: true}},
+			},
+		},
+		{
+			name:     "missing",
+			table:    "testtable",
+			wantArgs: []string{"", "testtable"},
+			rows:     sqlmock.NewRows(columns),
+		},
+		{
+			name:     "query-error",
+			table:    "testtable",
+			wantArgs: []string{"", "testtable"},
+			queryErr: errors.New("connection refused"),
+			err:      errors.New("connection refused"),
+		},
+		{
+			name:     "row-error",
+			table:    "testtable",
+			wantArgs: []string{"", "testtable"},
+			rows: sqlmock.NewRows(columns).
+				AddRow("public", "count", "integer", nil, 32, 0, "YES").
+				RowError(0, errors.New("read failed")),
+			err: errors.New("read failed"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+			svc := &DataLoader{DB: NewSQLExecutor(db), Logger: log.NewNopLogger()}
+
+			mock.ExpectBegin()
+			tx, err := svc.DB.BeginTx(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			query := mock.ExpectQuery(tableColumnsQuery).WithArgs(tt.wantArgs[0], tt.wantArgs[1])
+			if tt.queryErr != nil {
+				query.WillReturnError(tt.queryErr)
+			} else {
+				query.WillReturnRows(tt.rows)
+			}
+
+			got, err := svc.lookupTable(context.Background(), tx, tt.schema, tt.table)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("want: %+v, got: %+v", tt.want, got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestLookupTableClosesRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	svc := &DataLoader{DB: NewSQLExecutor(db), Logger: log.NewNopLogger()}
+
+	row := []string{"table_schema", "column_name", "data_type", "character_maximum_length", "numeric_precision",
+		"numeric_scale", "is_nullable"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(tableColumnsQuery).
+		WithArgs("", "testtable").
+		WillReturnRows(sqlmock.NewRows(row).
+			AddRow("public", "name", "character varying", 10, nil, nil, "YES").
+			AddRow("public", "count", "integer", nil, 32, 0, "YES"))
+	mock.ExpectCommit()
+
+	// Commit blocks for as long as rows of the transaction are left open
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.runInTransaction(context.Background(), func(ctx context.Context, tx Tx) error {
+			info, err := svc.lookupTable(ctx, tx, "", "TESTTABLE")
+			if err == nil && info == nil {
+				err = errors.New("want table to exist")
+			}
+			return err
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transaction did not commit, rows were left open")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateTablesStepChecksDrift(t *testing.T) {
+	columns := []string{"table_schema", "column_name", "data_type", "character_maximum_length", "numeric_precision",
+		"numeric_scale", "is_nullable"}
+	tests := []struct {
+		name    string
+		rows    *sqlmock.Rows
+		created bool
+		err     string
+	}{
+		{
+			name: "existing",
+			rows: sqlmock.NewRows(columns).
+				AddRow("raw", "name", "character varying", 20, nil, nil, "YES").
+				AddRow("raw", "amount", "numeric", nil, 7, 2, "YES"),
+		},
+		{
+			name:    "missing",
+			rows:    sqlmock.NewRows(columns),
+			created: true,
+		},
+		{
+			name: "drifted",
+			rows: sqlmock.NewRows(columns).
+				AddRow("raw", "name", "character varying", 5, nil, nil, "YES").
+				AddRow("raw", "amount", "integer", nil, 32, 0, "YES").
+				AddRow("raw", "note", "character varying", 100, nil, nil, "YES"),
+			err: "table raw.accounts drifted from its schema: column name holds 5 characters, not 10, " +
+				"column amount is integer, not numeric, column note is not in the schema",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+			svc := &DataLoader{DB: NewSQLExecutor(db), Logger: log.NewNopLogger()}
+			schema := &tableSchema{
+				TargetSchema: "raw",
+				Columns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "7", Name: "amount", DataType: "DECIMAL", Scale: 2},
+				},
+				Encoding: encodingUTF8,
+			}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta("CREATE SCHEMA IF NOT EXISTS raw;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(tableColumnsQuery).WithArgs("raw", "accounts").WillReturnRows(tt.rows)
+			if tt.created {
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE raw.accounts( name VARCHAR(10), amount DECIMAL(7,2));")).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+			if tt.err != "" {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			result := &LoadResult{}
+			err = svc.runInTransaction(context.Background(), svc.createTablesStep(schema, "accounts", result))
+			if tt.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.err != "" {
+				var schemaErr *SchemaError
+				if !errors.As(err, &schemaErr) || err.Error() != tt.err {
+					t.Errorf("want schema error: %s, got: %v", tt.err, err)
+				}
+			}
+			if created := result.table("raw.accounts").Created; created != tt.created {
+				t.Errorf("want created: %v, got: %v", tt.created, created)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckSchemaDrift(t *testing.T) {
+	layout := tableLayout{
+		Table: "accounts",
+		Columns: []dBColumnSchema{
+			{Width: "8", Name: "Opened", DataType: "TEXT", Transforms: []string{"date:YYYYMMDD"}},
+			{Width: "4", Name: "code", DataType: "TEXT"},
+		},
+		Metadata: []string{metadataLoadID},
+	}
+	opened := columnInfo{Name: "opened", DataType: "date"}
+	loadID := columnInfo{Name: "load_id", DataType: "character", CharacterMaxLength: 32}
+	tests := []struct {
+		name    string
+		columns []columnInfo
+		err     string
+	}{
+		{
+			name:    "same",
+			columns: []columnInfo{opened, {Name: "code", DataType: "character varying", CharacterMaxLength: 4}, loadID},
+		},
+		{
+			name:    "widened",
+			columns: []columnInfo{opened, {Name: "code", DataType: "character varying", CharacterMaxLength: 16}, loadID},
+		},
+		{
+			name:    "reordered",
+			columns: []columnInfo{{Name: "code", DataType: "character varying", CharacterMaxLength: 4}, opened, loadID},
+			err:     "column 1 is code, not opened, column 2 is opened, not code",
+		},
+		{
+			name:    "missing-metadata",
+			columns: []columnInfo{opened, {Name: "code", DataType: "character varying", CharacterMaxLength: 4}},
+			err:     "column load_id is missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSchemaDrift(layout, &tableInfo{Name: "accounts", Columns: tt.columns})
+			if tt.err == "" && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if want := "table accounts drifted from its schema: " + tt.err; tt.err != "" && (err == nil || err.Error() != want) {
+				t.Errorf("want: %s, got: %v", want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package dataloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout used for business dates in control records when the schema doesn't define one.
+const defaultDateFormat = "20060102"
+
+// controlSummary is what was learned about a file while stripping its control records.
+type controlSummary struct {
+	Rows         int64
+	BusinessDate time.Time
+}
+
+// Splits a fixed-width control record into its named field values.
+func (r *controlRecord) parse(line string) (map[string]string, error) {
+	line = strings.TrimRight(line, "\r\n")
+	chars := []rune(line)
+	values := make(map[string]string, len(r.Fields))
+	pos := 0
+	for _, f := range r.Fields {
+		if pos+f.Width > len(chars) {
+			return nil, fmt.Errorf("record too short for field %s: %q", f.Name, line)
+		}
+		values[f.Name] = strings.TrimSpace(string(chars[pos : pos+f.Width]))
+		pos += f.Width
+	}
+	return values, nil
+}
+
+// Checks the values of a parsed control record against what was actually found in the file and returns the business
+// date it carries, if any.
+func (r *controlRecord) verify(values map[string]string, rows int64, totals map[string]int64) (time.Time, error) {
+	if r.RecordCountField != "" {
+		want, err := strconv.ParseInt(values[r.RecordCountField], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid record count %q: %v", values[r.RecordCountField], err)
+		}
+		if want != rows {
+			return time.Time{}, fmt.Errorf("record count mismatch: control record says %d rows, file has %d", want, rows)
+		}
+	}
+	if r.ControlTotalField != "" {
+		want, err := strconv.ParseInt(values[r.ControlTotalField], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid control total %q: %v", values[r.ControlTotalField], err)
+		}
+		if got := totals[r.ControlTotalColumn]; want != got {
+			return time.Time{}, fmt.Errorf("control total mismatch for %s: control record says %d, file sums to %d",
+				r.ControlTotalColumn, want, got)
+		}
+	}
+	if r.BusinessDateField == "" {
+		return time.Time{}, nil
+	}
+	businessDate, err := time.Parse(r.BusinessDateFormat, values[r.BusinessDateField])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid business date %q: %v", values[r.BusinessDateField], err)
+	}
+	return businessDate, nil
+}
+
+// Copies the data rows of r into w, dropping the header and trailer records described by schema and verifying their
+// counts and control totals against the rows copied.
+func stripControlRecords(r io.Reader, w io.Writer, schema *tableSchema) (*controlSummary, error) {
+	totals, err := newColumnTotaller(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(r)
+	var headerValues, trailerValues map[string]string
+	if schema.Header != nil {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" {
+			return nil, fmt.Errorf("missing header record")
+		}
+		if headerValues, err = schema.Header.parse(line); err != nil {
+			return nil, fmt.Errorf("invalid header record: %v", err)
+		}
+	}
+
+	// Hold each line back by one so the final line can be treated as the trailer. An empty last line is only the
+	// file ending in a blank line, it's dropped so the record before it is the trailer.
+	summary := &controlSummary{}
+	var prev string
+	for {
+		line, err := br.ReadString('\n')
+		if line == "\n" || line == "\r\n" {
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				break
+			}
+		}
+		if line != "" {
+			if prev != "" {
+				if err := writeDataRow(w, prev, totals, summary); err != nil {
+					return nil, err
+				}
+			}
+			prev = line
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if schema.Trailer != nil {
+		if prev == "" {
+			return nil, fmt.Errorf("missing trailer record")
+		}
+		if trailerValues, err = schema.Trailer.parse(prev); err != nil {
+			return nil, fmt.Errorf("invalid trailer record: %v", err)
+		}
+	} else if prev != "" {
+		if err := writeDataRow(w, prev, totals, summary); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rec := range []struct {
+		name   string
+		layout *controlRecord
+		values map[string]string
+	}{
+		{"header", schema.Header, headerValues},
+		{"trailer", schema.Trailer, trailerValues},
+	} {
+		if rec.layout == nil {
+			continue
+		}
+		businessDate, err := rec.layout.verify(rec.values, summary.Rows, totals.sums)
+		if err != nil {
+			return nil, fmt.Errorf("%s record: %v", rec.name, err)
+		}
+		if !businessDate.IsZero() {
+			summary.BusinessDate = businessDate
+		}
+	}
+	return summary, nil
+}
+
+func writeDataRow(w io.Writer, line string, totals *columnTotaller, summary *controlSummary) error {
+	if err := totals.add(line); err != nil {
+		return fmt.Errorf("data row %d: %v", summary.Rows+1, err)
+	}
+	if _, err := io.WriteString(w, line); err != nil {
+		return err
+	}
+	summary.Rows++
+	return nil
+}
+
+// columnTotaller sums the INTEGER data columns control records carry hash totals for.
+type columnTotaller struct {
+	offsets map[string][2]int
+	sums    map[string]int64
+}
+
+func newColumnTotaller(schema *tableSchema) (*columnTotaller, error) {
+	t := &columnTotaller{offsets: make(map[string][2]int), sums: make(map[string]int64)}
+	wanted := make(map[string]struct{})
+	for _, rec := range []*controlRecord{schema.Header, schema.Trailer} {
+		if rec != nil && rec.ControlTotalColumn != "" {
+			wanted[rec.ControlTotalColumn] = struct{}{}
+		}
+	}
+	pos := 0
+	for _, col := range schema.Columns {
+		width, err := strconv.Atoi(col.Width)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := wanted[col.Name]; ok {
+			t.offsets[col.Name] = [2]int{pos, pos + width}
+		}
+		pos += width
+	}
+	return t, nil
+}
+
+func (t *columnTotaller) add(line string) error {
+	chars := []rune(strings.TrimRight(line, "\r\n"))
+	for name, off := range t.offsets {
+		if off[1] > len(chars) {
+			return fmt.Errorf("row too short for column %s", name)
+		}
+		raw := strings.TrimSpace(string(chars[off[0]:off[1]]))
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value for column %s: %v", name, err)
+		}
+		t.sums[name] += v
+	}
+	return nil
+}
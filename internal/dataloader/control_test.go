@@ -0,0 +1,129 @@
+package dataloader
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStripControlRecords(t *testing.T) {
+	columns := []dBColumnSchema{
+		{Width: "10", Name: "name", DataType: "TEXT"},
+		{Width: "1", Name: "valid", DataType: "BOOLEAN"},
+		{Width: "3", Name: "count", DataType: "INTEGER"},
+	}
+	header := &controlRecord{
+		Fields:             []controlField{{Name: "type", Width: 3}, {Name: "date", Width: 8}},
+		BusinessDateField:  "date",
+		BusinessDateFormat: defaultDateFormat,
+	}
+	trailer := &controlRecord{
+		Fields:             []controlField{{Name: "type", Width: 3}, {Name: "rows", Width: 5}, {Name: "total", Width: 6}},
+		RecordCountField:   "rows",
+		ControlTotalField:  "total",
+		ControlTotalColumn: "count",
+	}
+	data := "Foonyor   1  1\nBarzane   0-12\nQuuxitude 1103\n"
+	tests := []struct {
+		name     string
+		schema   *tableSchema
+		input    string
+		err      error
+		want     string
+		wantRows int64
+		wantDate time.Time
+	}{
+		{
+			name:     "header-and-trailer",
+			schema:   &tableSchema{Columns: columns, Header: header, Trailer: trailer},
+			input:    "HDR20150628\n" + data + "TRL00003000092",
+			want:     data,
+			wantRows: 3,
+			wantDate: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "trailer-only",
+			schema:   &tableSchema{Columns: columns, Trailer: trailer},
+			input:    data + "TRL00003000092\n",
+			want:     data,
+			wantRows: 3,
+		},
+		{
+			name:     "trailing-blank-line",
+			schema:   &tableSchema{Columns: columns, Header: header, Trailer: trailer},
+			input:    "HDR20150628\n" + data + "TRL00003000092\n\n",
+			want:     data,
+			wantRows: 3,
+			wantDate: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "trailing-blank-crlf-line",
+			schema:   &tableSchema{Columns: columns, Trailer: trailer},
+			input:    data + "TRL00003000092\r\n\r\n",
+			want:     data,
+			wantRows: 3,
+		},
+		{
+			name:     "header-only-no-trailing-newline",
+			schema:   &tableSchema{Columns: columns, Header: header},
+			input:    "HDR20150628\nFoonyor   1  1",
+			want:     "Foonyor   1  1",
+			wantRows: 1,
+			wantDate: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "record-count-mismatch",
+			schema: &tableSchema{Columns: columns, Trailer: trailer},
+			input:  data + "TRL00004000092\n",
+			err:    errors.New("trailer record: record count mismatch: control record says 4 rows, file has 3"),
+		},
+		{
+			name:   "control-total-mismatch",
+			schema: &tableSchema{Columns: columns, Trailer: trailer},
+			input:  data + "TRL00003000093\n",
+			err:    errors.New("trailer record: control total mismatch for count: control record says 93, file sums to 92"),
+		},
+		{
+			name:   "missing-header",
+			schema: &tableSchema{Columns: columns, Header: header},
+			input:  "",
+			err:    errors.New("missing header record"),
+		},
+		{
+			name:   "short-trailer",
+			schema: &tableSchema{Columns: columns, Trailer: trailer},
+			input:  data + "TRL0\n",
+			err:    errors.New("invalid trailer record: record too short for field rows: \"TRL0\""),
+		},
+		{
+			name:   "bad-business-date",
+			schema: &tableSchema{Columns: columns, Header: header},
+			input:  "HDR2015XX28\n" + data,
+			err: errors.New("header record: invalid business date \"2015XX28\": " +
+				"parsing time \"2015XX28\" as \"20060102\": cannot parse \"XX28\" as \"01\""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			got, err := stripControlRecords(strings.NewReader(tt.input), &out, tt.schema)
+			if tt.err != nil {
+				if err == nil || tt.err.Error() != err.Error() {
+					t.Errorf("want: %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("want: %q, got: %q", tt.want, out.String())
+			}
+			if got.Rows != tt.wantRows || !got.BusinessDate.Equal(tt.wantDate) {
+				t.Errorf("want: %d rows dated %v, got: %+v", tt.wantRows, tt.wantDate, got)
+			}
+		})
+	}
+}
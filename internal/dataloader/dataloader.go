@@ -1,8 +1,8 @@
 package dataloader
 
 import (
+	"bytes"
 	"context"
-	"database/sql"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -13,140 +13,437 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type dBColumnSchema struct {
 	Name     string
 	Width    string
 	DataType string
+
+	// DECIMAL only: number of implied decimal places and how the sign is encoded.
+	Scale int
+	Sign  string
+
+	// Clean-ups applied, in order, between the staging COPY and the insert into the real table.
+	Transforms []string
+
+	// Redshift compression encoding of the column in the real table, e.g. zstd.
+	Encode string
 }
 
 // DataLoader takes care of core functionality around data load for this application.
 type DataLoader struct {
-	DB           *sql.DB
+	DB           Executor
 	Logger       log.Logger
 	Env          string
 	DataBucket   string
 	SchemaBucket string
 	S3Svc        s3iface.S3API
+	// Database loaded into, TargetRedshift when empty.
+	Target string
+	// How failures classified as transient are retried, DefaultRetryPolicy for fields left zero.
+	Retry RetryPolicy
+	// Receives CloudWatch embedded metric format documents describing each load, none are written when nil.
+	Metrics io.Writer
+	// Table each load is recorded in, qualified with its schema if it has one, e.g. DefaultHistoryTable. Loads aren't
+	// recorded when empty.
+	HistoryTable string
+	// Creates the spans of each load. The global OpenTelemetry tracer, a no-op unless a provider is set up, when nil.
+	Tracer trace.Tracer
+
+	// Clock and load ID generator, overridden in tests
+	now    func() time.Time
+	loadID func() string
 }
 
-// LoadDataFileToRedshift takes a filename as input and loads it into designated target bucket
-func (d *DataLoader) LoadDataFileToRedshift(ctx context.Context, fileName string) error {
+// Returns the current time of the loader's clock.
+func (d *DataLoader) currentTime() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
 
+// LoadDataFileToRedshift takes a filename as input, loads it into designated target bucket and returns what the load
+// did. Failures are classified as SchemaError, DataError, TransientError or ConfigError where their cause is known.
+func (d *DataLoader) LoadDataFileToRedshift(ctx context.Context, fileName string) (_ *LoadResult, err error) {
+	start := time.Now()
 	targetName := strings.Split(fileName, "_")[0]
-
-	rawSchema, err := d.fetchTableSchema(ctx, targetName)
+	result := &LoadResult{Key: fileName, Target: targetName, StartedAt: d.currentTime()}
+	ctx, span := d.startSpan(ctx, "LoadDataFile", attrKey.String(fileName), attrTarget.String(targetName))
+	defer func() {
+		result.Durations.Total = time.Since(start)
+		err = classifyError(err)
+		d.writeMetrics(result, err)
+		d.recordHistory(result, err)
+		span.SetAttributes(attrLoadID.String(result.LoadID), attrRows.Int64(result.RowsLoaded()))
+		endSpan(span, err)
+	}()
+
+	phaseCtx, phaseSpan := d.startSpan(ctx, "FetchSchema", attrTarget.String(targetName))
+	schema, err := d.fetchTableSchema(phaseCtx, targetName)
+	endSpan(phaseSpan, err)
+	result.Durations.FetchSchema = time.Since(start)
 	if err != nil {
-		return err
+		return result, err
 	}
+	result.SchemaVersion = schema.Version
 
-	schema, err := marshalTableSchema(rawSchema)
+	phaseStart := time.Now()
+	phaseCtx, phaseSpan = d.startSpan(ctx, "Prepare", attrKey.String(fileName))
+	source, err := d.prepareSourceFile(phaseCtx, fileName, targetName, schema)
+	endSpan(phaseSpan, err)
+	result.Durations.Prepare = time.Since(phaseStart)
 	if err != nil {
-		return err
+		return result, err
 	}
+	defer d.cleanupSourceFile(ctx, source)
+	result.LoadID, result.Bytes = source.LoadID, source.Bytes
+
+	// A failed statement aborts its transaction, so retrying table creation or a COPY means running the whole
+	// transaction again
+	return result, d.withRetry(ctx, "load transaction", func() error {
+		// Tables created or loaded by an attempt that rolled back are neither, start over from the source rows
+		result.Tables = nil
+		for _, target := range source.Targets {
+			result.table(target.qualifiedTable()).SourceRows = target.Rows
+		}
+		return d.runInTransaction(ctx,
+			d.createTablesStep(schema, targetName, result),
+			d.copyStep(source, result),
+		)
+	})
+}
 
-	redShiftTableExists, err := d.checkIfRedShiftTableExists(ctx, targetName)
-	if err != nil {
-		return err
-	}
+// Red Shift Actions  ------------------------
 
-	if !redShiftTableExists {
-		err = d.createTable(ctx, targetName, schema)
-		if err != nil {
+// Returns the load step creating the schema and any table of the file that doesn't exist yet, recording the tables it
+// created in result.
+func (d *DataLoader) createTablesStep(schema *tableSchema, targetName string, result *LoadResult) loadStep {
+	return func(ctx context.Context, tx Tx) error {
+		start := time.Now()
+		defer func() { result.Durations.CreateTables = time.Since(start) }()
+
+		if err := d.createSchemaIfMissing(ctx, tx, schema.TargetSchema); err != nil {
 			return err
 		}
-	}
+		for _, layout := range schema.tableLayouts(targetName) {
+			spanCtx, span := d.startSpan(ctx, "CheckTable", attrTable.String(layout.qualifiedTable()))
+			info, err := d.lookupTable(spanCtx, tx, layout.Schema, layout.Table)
+			if err == nil && info != nil {
+				err = checkSchemaDrift(layout, info)
+			}
+			endSpan(span, err)
+			if err != nil {
+				return err
+			}
 
-	return d.executeRedShiftCopyCommand(ctx, schema, targetName, fileName)
+			if info == nil {
+				spanCtx, span = d.startSpan(ctx, "CreateTable", attrTable.String(layout.qualifiedTable()))
+				err = d.createTable(spanCtx, tx, layout)
+				endSpan(span, err)
+				if err != nil {
+					return err
+				}
+				result.table(layout.qualifiedTable()).Created = true
+			}
+		}
+		return nil
+	}
 }
 
-// Red Shift Actions  ------------------------
-
-// Checks if passed table exists in target redshift cluster
-func (d *DataLoader) checkIfRedShiftTableExists(ctx context.Context, tableName string) (bool, error) {
-	const tableExistsQuery = `SELECT TRUE WHERE EXISTS(SELECT * FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = $1);`
-	rows, err := d.DB.QueryContext(ctx, tableExistsQuery, tableName)
-	if err != nil {
-		return false, err
-	}
-	if !rows.Next() {
-		return false, nil
+// Returns the load step executing the COPY commands for every target of the passed source file, so either all of a
+// file's tables are loaded or none are. The rows each COPY loaded are recorded in result.
+func (d *DataLoader) copyStep(source *sourceFile, result *LoadResult) loadStep {
+	return func(ctx context.Context, tx Tx) error {
+		start := time.Now()
+		defer func() { result.Durations.Copy = time.Since(start) }()
+
+		for _, target := range source.Targets {
+			spanCtx, span := d.startSpan(ctx, "Copy",
+				attrTable.String(target.qualifiedTable()),
+				attrCopyKey.String(target.CopyKey),
+				attrLoadID.String(source.LoadID))
+			loadedRows, err := d.executeRedShiftCopyCommand(spanCtx, tx, source, target)
+			span.SetAttributes(attrRows.Int64(loadedRows))
+			endSpan(span, err)
+			table := result.table(target.qualifiedTable())
+			table.SourceRows, table.RowsLoaded = target.Rows, loadedRows
+			table.Mode = LoadModeDirect
+			if target.viaStagingTable() {
+				table.Mode = LoadModeStagingTable
+			}
+			if loadedRows < target.Rows {
+				table.RowsRejected = target.Rows - loadedRows
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	return true, nil
 }
 
-// Executes a redshift COPY command from passed to copyTarget s3 file into passed targetFile
-func (d *DataLoader) executeRedShiftCopyCommand(ctx context.Context, schema []dBColumnSchema, tableName, copyTarget string) error {
+// Executes a redshift COPY command from the target's s3 file into its table. Fails if pg_last_copy_count() disagrees
+// with the number of rows found in the source file. Targets with metadata columns are COPYed into a temporary staging
+// table and inserted from there with the metadata values added. Returns the number of rows COPY loaded.
+func (d *DataLoader) executeRedShiftCopyCommand(ctx context.Context, tx Tx, source *sourceFile, target copyTarget) (int64, error) {
 	start := time.Now()
 	level.Info(d.Logger).Log("msg", "attempting copy command",
-		"table_name", tableName,
-		"copy_target", copyTarget)
-	_, err := d.DB.ExecContext(ctx, d.buildCopyFromS3Query(schema, tableName, copyTarget))
+		"table_name", target.qualifiedTable(),
+		"copy_target", target.CopyKey,
+		"load_id", source.LoadID)
+	var loadedRows int64
+	err := d.createStagingTable(ctx, tx, target)
+	if err == nil {
+		loadedRows, err = d.copyAndCount(ctx, tx, target)
+	}
+	if err == nil && loadedRows != target.Rows {
+		err = &DataError{fmt.Errorf("row count mismatch for %s: source file has %d rows, copy loaded %d", target.CopyKey, target.Rows, loadedRows)}
+	}
+	if err == nil {
+		err = d.insertFromStagingTable(ctx, tx, source, target)
+	}
 	if err != nil {
 		level.Error(d.Logger).Log("msg", "copy command failure",
 			"elapsed_time", time.Now().Sub(start),
-			"table_name", tableName,
-			"copy_target", copyTarget,
+			"table_name", target.qualifiedTable(),
+			"copy_target", target.CopyKey,
+			"source_rows", target.Rows,
+			"loaded_rows", loadedRows,
 			"err", err)
-		return err
+		return loadedRows, err
 	}
 	level.Info(d.Logger).Log("msg", "copy command complete",
 		"elapsed_time", time.Now().Sub(start),
-		"table_name", tableName,
-		"copy_target", copyTarget)
+		"table_name", target.qualifiedTable(),
+		"copy_target", target.CopyKey,
+		"source_rows", target.Rows,
+		"loaded_rows", loadedRows)
+	return loadedRows, nil
+}
+
+// Runs the COPY of the target inside passed transaction and returns the number of rows the database reports it loaded
+func (d *DataLoader) copyAndCount(ctx context.Context, tx Tx, target copyTarget) (int64, error) {
+	const lastCopyCountQuery = `SELECT pg_last_copy_count();`
+	if d.Target == TargetPostgres {
+		return d.copyFromStdin(ctx, tx, target)
+	}
+	_, err := tx.ExecContext(ctx, d.buildCopyFromS3Query(target.CopyColumns, target.copyTable(), target.CopyKey))
+	if err != nil {
+		return 0, err
+	}
+	var loadedRows int64
+	err = tx.QueryRowContext(ctx, lastCopyCountQuery).Scan(&loadedRows)
+	return loadedRows, err
+}
+
+// Creates the temporary table targets needing one are COPYed into
+func (d *DataLoader) createStagingTable(ctx context.Context, tx Tx, target copyTarget) error {
+	if !target.viaStagingTable() {
+		return nil
+	}
+	createStagingQuery, err := d.buildCreateStagingTableQuery(target.copyTable(), target.Columns, target.Encoding)
+	if err != nil {
+		return &SchemaError{err}
+	}
+	_, err = tx.ExecContext(ctx, createStagingQuery)
 	return err
 }
 
-// Creates table in target redshift DB with passed expectedSchema
-func (d *DataLoader) createTable(ctx context.Context, tableName string, schema []dBColumnSchema) error {
-	level.Info(d.Logger).Log("msg", "table not found creating new one", "table_name", tableName)
-	createTableQuery, err := d.buildCreateTableQuery(tableName, schema)
+// Moves rows from the target's staging table into the target table, adding metadata values, then drops the staging
+// table
+func (d *DataLoader) insertFromStagingTable(ctx context.Context, tx Tx, source *sourceFile, target copyTarget) error {
+	if !target.viaStagingTable() {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, d.buildInsertFromStagingQuery(source, target))
 	if err != nil {
 		return err
 	}
-	_, err = d.DB.ExecContext(ctx, createTableQuery)
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s;", target.copyTable()))
+	return err
+}
+
+// Creates table in target redshift DB with passed expectedSchema and metadata columns
+func (d *DataLoader) createTable(ctx context.Context, tx Tx, layout tableLayout) error {
+	tableName := layout.qualifiedTable()
+	level.Info(d.Logger).Log("msg", "table not found creating new one", "table_name", tableName)
+	createTableQuery, err := d.buildCreateTableQuery(layout)
 	if err != nil {
+		return &SchemaError{err}
+	}
+	_, err = tx.ExecContext(ctx, createTableQuery)
+	if err == nil {
 		level.Info(d.Logger).Log("msg", "created table successfully", "table_name", tableName)
 	}
-	return err
+	return classifyCreateError(err)
 }
 
 // S3 Actions ----------------------------
 
-// Fetches the expectedSchema CSV from remote s3 bucket.
-func (d *DataLoader) fetchTableSchema(ctx context.Context, targetName string) (io.ReadCloser, error) {
+// Fetches the expectedSchema from remote s3 bucket, retrying transient failures. A JSON table definition is preferred,
+// falling back to the plain column CSV when there isn't one.
+func (d *DataLoader) fetchTableSchema(ctx context.Context, targetName string) (schema *tableSchema, err error) {
+	err = d.withRetry(ctx, "fetch schema", func() error {
+		schema, err = d.fetchTableSchemaOnce(ctx, targetName)
+		return err
+	})
+	return schema, err
+}
+
+func (d *DataLoader) fetchTableSchemaOnce(ctx context.Context, targetName string) (*tableSchema, error) {
 	level.Info(d.Logger).Log("msg", "loading data expectedSchema", "schema_bucket", d.SchemaBucket, "schema_name", targetName)
+	rawSchema, version, err := d.fetchSchemaObject(ctx, targetName+".json")
+	if err == nil {
+		defer rawSchema.Close()
+		schema, err := unmarshalTableDefinition(rawSchema)
+		if configErr, ok := err.(*ConfigError); ok {
+			return nil, configErr
+		}
+		if err != nil {
+			return nil, &SchemaError{err}
+		}
+		schema.Version = version
+		return schema, nil
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != s3.ErrCodeNoSuchKey {
+		return nil, err
+	}
+
+	rawSchema, version, err = d.fetchSchemaObject(ctx, targetName+".csv")
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		// Neither definition exists
+		return nil, &SchemaError{err}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rawSchema.Close()
+	columns, err := marshalTableSchema(rawSchema)
+	if err != nil {
+		return nil, &SchemaError{err}
+	}
+	return &tableSchema{Columns: columns, Version: version}, nil
+}
+
+// Fetches a schema object, returning its body and its ETag as the version of the definition.
+func (d *DataLoader) fetchSchemaObject(ctx context.Context, key string) (io.ReadCloser, string, error) {
 	schemaRsp, err := d.S3Svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(d.SchemaBucket),
-		Key:    aws.String(targetName + ".csv"),
+		Key:    aws.String(key),
 	})
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
-	return schemaRsp.Body, nil
+	return schemaRsp.Body, strings.Trim(aws.StringValue(schemaRsp.ETag), `"`), nil
+}
+
+// Counts the records in the source data file so they can be reconciled against what COPY loaded. Also returns the
+// size of the file.
+func (d *DataLoader) countSourceRows(ctx context.Context, fileName string) (int64, int64, error) {
+	dataRsp, err := d.S3Svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.DataBucket),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer dataRsp.Body.Close()
+	sourceRows, err := countRecords(dataRsp.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	level.Info(d.Logger).Log("msg", "counted source rows", "data_bucket", d.DataBucket, "file_name", fileName, "source_rows", sourceRows)
+	return sourceRows, aws.Int64Value(dataRsp.ContentLength), nil
 }
 
 // Query Builders ----------------------
 
-// Builds CREATE TABLE query from passed table name and expectedSchema. Try's to make TEXT fields as small as possible
-// based off width.
-func (d *DataLoader) buildCreateTableQuery(tableName string, dbColumns []dBColumnSchema) (string, error) {
+// Builds CREATE TABLE query from passed table name, expectedSchema and metadata columns. Try's to make TEXT fields as
+// small as possible based off width.
+func (d *DataLoader) buildCreateTableQuery(layout tableLayout) (string, error) {
+	dbColumns, metadata := layout.Columns, layout.Metadata
 
 	// Validate col length
-	numOfCol := len(dbColumns)
-	if numOfCol == 0 || numOfCol > 1600 {
+	numOfCol := len(dbColumns) + len(metadata)
+	if len(dbColumns) == 0 || numOfCol > 1600 {
 		// https://docs.aws.amazon.com/redshift/latest/dg/r_CREATE_TABLE_usage.html
 		return "", fmt.Errorf("invalid number of columns defined in expectedSchema: %d", numOfCol)
 	}
 
+	if d.Target == TargetPostgres {
+		layout = withoutRedshiftAttributes(layout)
+		dbColumns = layout.Columns
+	}
+	columnDefinitions, err := buildColumnDefinitions(dbColumns, d.varcharBytesPerChar(layout.Encoding))
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("CREATE TABLE %s(%s", layout.qualifiedTable(), columnDefinitions))
+	for _, name := range metadata {
+		sb.WriteString(fmt.Sprintf(", %s %s", name, metadataColumnTypes[name]))
+	}
+	sb.WriteString(")" + layout.Options.render() + ";")
+
+	generatedQuery := sb.String()
+	level.Debug(d.Logger).Log("msg", "built create table query", "generated_query", generatedQuery)
+	return generatedQuery, nil
+}
+
+// Builds CREATE TEMP TABLE query for the table a target is COPYed into before being inserted into its real table.
+func (d *DataLoader) buildCreateStagingTableQuery(stagingTable string, dbColumns []dBColumnSchema, encoding string) (string, error) {
+	columnDefinitions, err := buildColumnDefinitions(rawColumns(dbColumns), d.varcharBytesPerChar(encoding))
+	if err != nil {
+		return "", err
+	}
+	generatedQuery := fmt.Sprintf("CREATE TEMP TABLE %s(%s);", stagingTable, columnDefinitions)
+	level.Debug(d.Logger).Log("msg", "built create staging table query", "generated_query", generatedQuery)
+	return generatedQuery, nil
+}
+
+// Builds INSERT ... SELECT query moving a target's rows from its staging table into its table, applying column
+// transforms and adding the metadata values of this load.
+func (d *DataLoader) buildInsertFromStagingQuery(source *sourceFile, target copyTarget) string {
+	var columns, values []string
+	for _, col := range target.Columns {
+		columns = append(columns, col.Name)
+		values = append(values, transformExpression(col))
+	}
+	for _, name := range target.Metadata {
+		columns = append(columns, name)
+		values = append(values, metadataValue(name, source))
+	}
+	generatedQuery := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;",
+		target.qualifiedTable(),
+		strings.Join(columns, ", "),
+		strings.Join(values, ", "),
+		target.copyTable())
+	level.Debug(d.Logger).Log("msg", "built insert from staging query", "generated_query", generatedQuery)
+	return generatedQuery
+}
+
+// Returns how many bytes a VARCHAR reserves per character of a field in the passed source encoding. Redshift counts
+// VARCHAR lengths in bytes of UTF-8, PostgreSQL counts characters.
+func (d *DataLoader) varcharBytesPerChar(encoding string) int {
+	if d.Target == TargetPostgres {
+		return 1
+	}
+	return maxUTF8Bytes(encoding)
+}
+
+// Renders the column definitions of a CREATE TABLE from passed expectedSchema, validating each column on the way.
+// TEXT columns reserve bytesPerChar bytes for every character of their width.
+func buildColumnDefinitions(dbColumns []dBColumnSchema, bytesPerChar int) (string, error) {
 	//Loop thorough columns build up query
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("CREATE TABLE %s(", tableName))
 	prefix := ""
 	set := make(map[string]struct{})
 	for _, colProps := range dbColumns {
@@ -173,7 +470,26 @@ func (d *DataLoader) buildCreateTableQuery(tableName string, dbColumns []dBColum
 			}
 
 			// Create column with minimum bytes needed based off expectedSchema width
-			renderedDataType = fmt.Sprintf("VARCHAR(%s)", colProps.Width)
+			renderedDataType = fmt.Sprintf("VARCHAR(%d)", textWidth*bytesPerChar)
+
+		case "DECIMAL":
+			width, err := strconv.Atoi(colProps.Width)
+			if err != nil {
+				return "", err
+			}
+			switch colProps.Sign {
+			case signNone, signLeading, signTrailing, signOverpunch:
+			default:
+				return "", fmt.Errorf("unknown sign convention passed %s", colProps.Sign)
+			}
+			precision := decimalPrecision(width, colProps.Sign)
+			if precision < 1 || precision > maxDecimalPrecision {
+				return "", fmt.Errorf("passed column width %s gives invalid DECIMAL precision %d", colProps.Width, precision)
+			}
+			if colProps.Scale < 0 || colProps.Scale > precision {
+				return "", fmt.Errorf("passed column scale %d is invalid for DECIMAL precision %d", colProps.Scale, precision)
+			}
+			renderedDataType = fmt.Sprintf("DECIMAL(%d,%d)", precision, colProps.Scale)
 
 		case "INTEGER":
 			fallthrough
@@ -182,14 +498,19 @@ func (d *DataLoader) buildCreateTableQuery(tableName string, dbColumns []dBColum
 		default:
 			return "", fmt.Errorf("unknown data type passed %s", colProps.DataType)
 		}
+		if transformedType := transformedDataType(colProps); transformedType != "" {
+			renderedDataType = transformedType
+		}
+		if err := validateColumnEncoding(colProps); err != nil {
+			return "", err
+		}
 		sb.WriteString(fmt.Sprintf(" %s %s", colProps.Name, renderedDataType))
+		if colProps.Encode != "" {
+			sb.WriteString(" ENCODE " + strings.ToUpper(colProps.Encode))
+		}
 		prefix = ","
 	}
-	sb.WriteString(");")
-
-	generatedQuery := sb.String()
-	level.Debug(d.Logger).Log("msg", "built create table query", "generated_query", generatedQuery)
-	return generatedQuery, nil
+	return sb.String(), nil
 }
 
 // Builds a COPY query from passed target details. Leverages fixed width data format based off passed expectedSchema.
@@ -232,17 +553,55 @@ func marshalTableSchema(rawSchema io.ReadCloser) ([]dBColumnSchema, error) {
 		if i == 0 {
 			continue
 		}
-		dbColumns = append(dbColumns, dBColumnSchema{
+		col := dBColumnSchema{
 			Name:     line[0],
 			Width:    line[1],
 			DataType: line[2],
-		})
+		}
+		// Optional DECIMAL scale and sign columns
+		if len(line) > 3 && line[3] != "" {
+			if col.Scale, err = strconv.Atoi(line[3]); err != nil {
+				return nil, err
+			}
+		}
+		if len(line) > 4 {
+			col.Sign = line[4]
+		}
+		dbColumns = append(dbColumns, col)
 	}
 	return dbColumns, nil
 }
 
 // Utility Functions ------------------------
 
+// Counts newline terminated records in r. A final record without a trailing newline is still counted.
+func countRecords(r io.Reader) (int64, error) {
+	var (
+		count int64
+		read  int64
+		last  byte
+		buf   = make([]byte, 32*1024)
+	)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			count += int64(bytes.Count(buf[:n], []byte{'\n'}))
+			last = buf[n-1]
+			read += int64(n)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if read > 0 && last != '\n' {
+		count++
+	}
+	return count, nil
+}
+
 // NewLogger builds a standard logger object that follows best practices.
 func NewLogger(w io.Writer) log.Logger {
 	logger := log.With(
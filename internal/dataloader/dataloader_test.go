@@ -7,14 +7,12 @@ import (
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"io/ioutil"
+	"reflect"
 	"regexp"
 	"strings"
 	"testing"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/request"
-	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/ellery44/data-loader/internal/s3test"
 	"github.com/go-kit/kit/log"
 )
 
@@ -93,6 +91,52 @@ func TestBuildCreateTableQuery(t *testing.T) {
 			},
 			err: errors.New("duplicate column name passed in expectedSchema: testCol"),
 		},
+		{
+			name: "schema-decimal",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+			},
+			schema: []dBColumnSchema{
+				{Width: "7", Name: "testCol1", DataType: "DECIMAL", Scale: 2},
+				{Width: "7", Name: "testCol2", DataType: "DECIMAL", Scale: 2, Sign: "leading"},
+				{Width: "7", Name: "testCol3", DataType: "DECIMAL", Scale: 2, Sign: "overpunch"},
+			},
+			want: "CREATE TABLE testTable( testCol1 DECIMAL(7,2), testCol2 DECIMAL(6,2), testCol3 DECIMAL(7,2));",
+		},
+		{
+			name: "schema-decimal-unknown-sign",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+			},
+			schema: []dBColumnSchema{
+				{Width: "7", Name: "testCol", DataType: "DECIMAL", Sign: "sideways"},
+			},
+			err: errors.New("unknown sign convention passed sideways"),
+		},
+		{
+			name: "schema-decimal-too-wide",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+			},
+			schema: []dBColumnSchema{
+				{Width: "39", Name: "testCol", DataType: "DECIMAL"},
+			},
+			err: errors.New("passed column width 39 gives invalid DECIMAL precision 39"),
+		},
+		{
+			name: "schema-decimal-bad-scale",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+			},
+			schema: []dBColumnSchema{
+				{Width: "3", Name: "testCol", DataType: "DECIMAL", Scale: 3, Sign: "trailing"},
+			},
+			err: errors.New("passed column scale 3 is invalid for DECIMAL precision 2"),
+		},
 		{
 			name: "schema-bad-width",
 			svc: &DataLoader{
@@ -107,7 +151,7 @@ func TestBuildCreateTableQuery(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.svc.buildCreateTableQuery("testTable", tt.schema)
+			got, err := tt.svc.buildCreateTableQuery(tableLayout{Table: "testTable", Columns: tt.schema})
 			if tt.err != nil && tt.err.Error() != err.Error() {
 				t.Errorf("want: %v, got: %v", tt.err, err)
 			}
@@ -166,7 +210,7 @@ func TestCreateCopyCommandQuery(t *testing.T) {
 }
 
 func TestCreateTable(t *testing.T) {
-	db, _, err := sqlmock.New()
+	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Errorf("An error '%s' was not expected when opening a stub database connection", err)
 	}
@@ -182,7 +226,7 @@ func TestCreateTable(t *testing.T) {
 			svc: &DataLoader{
 				DataBucket: "testDB",
 				Logger:     log.NewNopLogger(),
-				DB:         db,
+				DB:         NewSQLExecutor(db),
 			},
 			schema: []dBColumnSchema{
 				{Width: "4", Name: "testCol1", DataType: "TEXT"},
@@ -197,7 +241,7 @@ func TestCreateTable(t *testing.T) {
 			svc: &DataLoader{
 				DataBucket: "testDB",
 				Logger:     log.NewNopLogger(),
-				DB:         db,
+				DB:         NewSQLExecutor(db),
 			},
 			schema: []dBColumnSchema{
 				{Width: "4", Name: "testCol1", DataType: "TEXT"},
@@ -208,7 +252,12 @@ func TestCreateTable(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.svc.createTable(context.Background(), "testtable", tt.schema)
+			mock.ExpectBegin()
+			tx, err := tt.svc.DB.BeginTx(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = tt.svc.createTable(context.Background(), tx, tableLayout{Table: "testtable", Columns: tt.schema})
 			if tt.err != nil && tt.err.Error() != err.Error() {
 				t.Errorf("want: %v, got: %v", tt.err, err)
 			}
@@ -222,44 +271,60 @@ func TestCreateTable(t *testing.T) {
 }
 
 func TestExecuteCopy(t *testing.T) {
-	db, _, err := sqlmock.New()
-	if err != nil {
-		t.Errorf("An error '%s' was not expected when opening a stub database connection", err)
-	}
 	tests := []struct {
-		name   string
-		svc    *DataLoader
-		schema []dBColumnSchema
-		err    error
-		want   string
+		name       string
+		schema     []dBColumnSchema
+		sourceRows int64
+		loadedRows int64
+		copyErr    error
+		err        error
+		want       string
 	}{
 		{
 			name: "happy-path-1",
-			svc: &DataLoader{
-				DataBucket: "testDB",
-				Logger:     log.NewNopLogger(),
-				DB:         db,
-			},
 			schema: []dBColumnSchema{
 				{Width: "4", Name: "testCol1", DataType: "TEXT"},
 				{Width: "42", Name: "testCol2", DataType: "TEXT"},
 				{Width: "8", Name: "testCol3", DataType: "BOOLEAN"},
 				{Width: "4", Name: "testCol4", DataType: "INTEGER"},
 			},
+			sourceRows: 3,
+			loadedRows: 3,
 			want: "COPY testtable FROM 's3://testDB/testtarget' " +
 				"IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy--us-west-2' " +
 				"FIXEDWIDTH 'testCol1:4, testCol2:42, testCol3:8, testCol4:4';",
 		},
 		{
 			name: "happy-path-2",
-			svc: &DataLoader{
-				DataBucket: "testDB",
-				Logger:     log.NewNopLogger(),
-				DB:         db,
+			schema: []dBColumnSchema{
+				{Width: "4", Name: "testCol4", DataType: "INTEGER"},
+			},
+			sourceRows: 1,
+			loadedRows: 1,
+			want: "COPY testtable FROM 's3://testDB/testtarget' " +
+				"IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy--us-west-2' " +
+				"FIXEDWIDTH 'testCol4:4';",
+		},
+		{
+			name: "row-count-mismatch",
+			schema: []dBColumnSchema{
+				{Width: "4", Name: "testCol4", DataType: "INTEGER"},
 			},
+			sourceRows: 3,
+			loadedRows: 2,
+			err:        errors.New("row count mismatch for testtarget: source file has 3 rows, copy loaded 2"),
+			want: "COPY testtable FROM 's3://testDB/testtarget' " +
+				"IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy--us-west-2' " +
+				"FIXEDWIDTH 'testCol4:4';",
+		},
+		{
+			name: "copy-failure",
 			schema: []dBColumnSchema{
 				{Width: "4", Name: "testCol4", DataType: "INTEGER"},
 			},
+			sourceRows: 1,
+			copyErr:    errors.New("test_error"),
+			err:        errors.New("test_error"),
 			want: "COPY testtable FROM 's3://testDB/testtarget' " +
 				"IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy--us-west-2' " +
 				"FIXEDWIDTH 'testCol4:4';",
@@ -267,53 +332,159 @@ func TestExecuteCopy(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := tt.svc.executeRedShiftCopyCommand(context.Background(), tt.schema, "testtable", "testtarget")
-			if tt.err != nil && tt.err.Error() != err.Error() {
-				t.Errorf("want: %v, got: %v", tt.err, err)
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
 			}
-			mockRsp := err.Error()
-			if !strings.Contains(mockRsp, tt.want) {
-				t.Errorf("want: %s, got: %s", tt.want, mockRsp)
+			defer db.Close()
+			svc := &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+				DB:         NewSQLExecutor(db),
 			}
 
+			mock.ExpectBegin()
+			copyExec := mock.ExpectExec(regexp.QuoteMeta(tt.want))
+			if tt.copyErr != nil {
+				copyExec.WillReturnError(tt.copyErr)
+			} else {
+				copyExec.WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_last_copy_count();")).
+					WillReturnRows(sqlmock.NewRows([]string{"pg_last_copy_count"}).AddRow(tt.loadedRows))
+			}
+			if tt.err != nil {
+				mock.ExpectRollback()
+			} else {
+				mock.ExpectCommit()
+			}
+
+			err = svc.runInTransaction(context.Background(), svc.copyStep(&sourceFile{
+				Key: "testtarget",
+				Targets: []copyTarget{
+					{Table: "testtable", Columns: tt.schema, CopyColumns: tt.schema, CopyKey: "testtarget", Rows: tt.sourceRows},
+				},
+			}, &LoadResult{}))
+			if tt.err == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.err != nil && (err == nil || tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet sql expectations: %v", err)
+			}
 		})
 	}
 }
 
+func TestExecuteCopyMultipleTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("An error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	svc := &DataLoader{
+		DataBucket: "testDB",
+		Logger:     log.NewNopLogger(),
+		DB:         NewSQLExecutor(db),
+	}
+	columns := []dBColumnSchema{{Width: "2", Name: "type", DataType: "TEXT"}}
+	source := &sourceFile{
+		Key: "f.txt",
+		Targets: []copyTarget{
+			{Table: "orders", Columns: columns, CopyColumns: columns, CopyKey: "staging/orders/f.txt", Rows: 2},
+			{Table: "lines", Columns: columns, CopyColumns: columns, CopyKey: "staging/lines/f.txt", Rows: 5},
+		},
+	}
+
+	// Second table failing reconciliation must roll back the first table's COPY too
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("COPY orders FROM 's3://testDB/staging/orders/f.txt'")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_last_copy_count();")).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_last_copy_count"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta("COPY lines FROM 's3://testDB/staging/lines/f.txt'")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_last_copy_count();")).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_last_copy_count"}).AddRow(4))
+	mock.ExpectRollback()
+
+	err = svc.runInTransaction(context.Background(), svc.copyStep(source, &LoadResult{}))
+	want := "row count mismatch for staging/lines/f.txt: source file has 5 rows, copy loaded 4"
+	if err == nil || err.Error() != want {
+		t.Errorf("want: %s, got: %v", want, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet sql expectations: %v", err)
+	}
+}
+
 func TestFetchTableSchema(t *testing.T) {
 	tests := []struct {
-		name string
-		svc  *DataLoader
-		err  error
+		name    string
+		svc     *DataLoader
+		err     error
+		columns int
+		trailer bool
 	}{
 		{
-			name: "happy-path",
+			name: "csv-schema",
 			svc: &DataLoader{
-				DataBucket: "testDB",
-				Logger:     log.NewNopLogger(),
-				S3Svc: &mockS3{
-					errToReturn: nil,
-				},
+				SchemaBucket: "testSchemas",
+				Logger:       log.NewNopLogger(),
+				S3Svc: newFakeS3("testSchemas", map[string]string{
+					"foo.csv": "\"column name\",width,datatype\nname,10,TEXT\nvalid,1,BOOLEAN\n",
+				}),
 			},
-			err: nil,
+			columns: 2,
+		},
+		{
+			name: "json-schema-preferred",
+			svc: &DataLoader{
+				SchemaBucket: "testSchemas",
+				Logger:       log.NewNopLogger(),
+				S3Svc: newFakeS3("testSchemas", map[string]string{
+					"foo.csv": "\"column name\",width,datatype\nname,10,TEXT\nvalid,1,BOOLEAN\n",
+					"foo.json": `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}],
+						"trailer": {"fields": [{"name": "count", "width": 5}], "record_count_field": "count"}}`,
+				}),
+			},
+			columns: 1,
+			trailer: true,
+		},
+		{
+			name: "schema-missing",
+			svc: &DataLoader{
+				SchemaBucket: "testSchemas",
+				Logger:       log.NewNopLogger(),
+				S3Svc:        &s3test.Fake{},
+			},
+			err: errors.New("NoSuchKey: The specified key does not exist."),
 		},
 		{
 			name: "s3-read-error",
 			svc: &DataLoader{
 				DataBucket: "testDB",
 				Logger:     log.NewNopLogger(),
-				S3Svc: &mockS3{
-					errToReturn: errors.New("test_error"),
-				},
+				S3Svc:      &s3test.Fake{Err: errors.New("test_error")},
 			},
 			err: errors.New("test_error"),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := tt.svc.fetchTableSchema(context.Background(), "foo")
-			if tt.err != nil && tt.err.Error() != err.Error() {
-				t.Errorf("want: %v, got: %v", tt.err, err)
+			got, err := tt.svc.fetchTableSchema(context.Background(), "foo")
+			if tt.err != nil {
+				if err == nil || tt.err.Error() != err.Error() {
+					t.Errorf("want: %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got.Columns) != tt.columns || (got.Trailer != nil) != tt.trailer {
+				t.Errorf("want: %d columns trailer %v, got: %+v", tt.columns, tt.trailer, got)
 			}
 		})
 	}
@@ -344,6 +515,23 @@ func TestMarshalSchema(t *testing.T) {
 name,10,TEXT
 valid,1,BOOLEAN
 count,3,INTEGER
+`,
+		},
+		{
+			name: "decimal-options",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+			},
+			expectedSchema: []dBColumnSchema{
+				{Width: "10", Name: "name", DataType: "TEXT"},
+				{Width: "7", Name: "amount", DataType: "DECIMAL", Scale: 2, Sign: "overpunch"},
+			},
+			err: nil,
+			rawSchema: `
+"column name",width,datatype,scale,sign
+name,10,TEXT,,
+amount,7,DECIMAL,2,overpunch
 `,
 		},
 	}
@@ -354,9 +542,7 @@ count,3,INTEGER
 				t.Errorf("want: %v, got: %v", tt.err, err)
 			}
 			for i, dBColumnSchema := range tt.expectedSchema {
-				if got[i].Name != dBColumnSchema.Name ||
-					got[i].Width != dBColumnSchema.Width ||
-					got[i].DataType != dBColumnSchema.DataType {
+				if !reflect.DeepEqual(got[i], dBColumnSchema) {
 					t.Errorf("want: %+v, got: %+v", tt.expectedSchema, got)
 				}
 			}
@@ -364,6 +550,73 @@ count,3,INTEGER
 	}
 }
 
+func TestCountRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int64
+	}{
+		{name: "empty", input: "", want: 0},
+		{name: "trailing-newline", input: "Foonyor   1  1\nBarzane   0-12\n", want: 2},
+		{name: "no-trailing-newline", input: "Foonyor   1  1\nBarzane   0-12\nQuuxitude 1103", want: 3},
+		{name: "single-record", input: "Foonyor   1  1", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countRecords(strings.NewReader(tt.input))
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.want != got {
+				t.Errorf("want: %d, got: %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCountSourceRows(t *testing.T) {
+	tests := []struct {
+		name string
+		svc  *DataLoader
+		err  error
+		want int64
+		size int64
+	}{
+		{
+			name: "happy-path",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+				S3Svc: newFakeS3("testDB", map[string]string{
+					"testformat1_2015-06-28.txt": "Foonyor   1  1\nBarzane   0-12\nQuuxitude 1103",
+				}),
+			},
+			want: 3,
+			size: 44,
+		},
+		{
+			name: "s3-read-error",
+			svc: &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+				S3Svc:      &s3test.Fake{Err: errors.New("test_error")},
+			},
+			err: errors.New("test_error"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, size, err := tt.svc.countSourceRows(context.Background(), "testformat1_2015-06-28.txt")
+			if tt.err != nil && tt.err.Error() != err.Error() {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if tt.want != got || tt.size != size {
+				t.Errorf("want: %d rows %d bytes, got: %d rows %d bytes", tt.want, tt.size, got, size)
+			}
+		})
+	}
+}
+
 func TestLog(t *testing.T) {
 	buf := &bytes.Buffer{}
 	logger := NewLogger(buf)
@@ -375,20 +628,28 @@ func TestLog(t *testing.T) {
 	}
 }
 
-// Mock Services -------------
-
-type mockS3 struct {
-	s3iface.S3API
-	errToReturn error
+func TestCreateTableLogsSuccess(t *testing.T) {
+	layout := tableLayout{Table: "testtable", Columns: []dBColumnSchema{{Width: "4", Name: "name", DataType: "TEXT"}}}
+	for _, createErr := range []error{nil, errors.New("permission denied")} {
+		buf := &bytes.Buffer{}
+		svc := &DataLoader{Logger: NewLogger(buf), DB: &recordingExecutor{errs: map[string]error{"CREATE TABLE": createErr}}}
+		tx, _ := svc.DB.BeginTx(context.Background())
+		err := svc.createTable(context.Background(), tx, layout)
+		if logged := strings.Contains(buf.String(), "created table successfully"); logged != (err == nil) {
+			t.Errorf("want success logged: %v, got: %v for %v", err == nil, logged, err)
+		}
+	}
 }
 
-func (c *mockS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
-	if c.errToReturn != nil {
-		return nil, c.errToReturn
+// Mock Services -------------
+
+// Returns a fake S3 holding objects in bucket.
+func newFakeS3(bucket string, objects map[string]string) *s3test.Fake {
+	fake := &s3test.Fake{}
+	for key, body := range objects {
+		fake.Put(bucket, key, body)
 	}
-	return &s3.GetObjectOutput{
-		Body: ioutil.NopCloser(bytes.NewReader([]byte("foo"))),
-	}, nil
+	return fake
 }
 
 // Helper functions --------
@@ -0,0 +1,158 @@
+package dataloader
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Redshift distribution styles. https://docs.aws.amazon.com/redshift/latest/dg/c_choosing_dist_sort.html
+const (
+	distStyleAuto = "AUTO"
+	distStyleEven = "EVEN"
+	distStyleKey  = "KEY"
+	distStyleAll  = "ALL"
+)
+
+// Redshift sort key styles and the most columns each allows.
+// https://docs.aws.amazon.com/redshift/latest/dg/t_Sorting_data.html
+const (
+	sortKeyCompound    = "COMPOUND"
+	sortKeyInterleaved = "INTERLEAVED"
+
+	maxCompoundSortKeys    = 400
+	maxInterleavedSortKeys = 8
+)
+
+// tableOptions are the physical layout options of a redshift table. The zero value leaves everything to redshift.
+type tableOptions struct {
+	DistStyle string
+	// Column rows are distributed on, implies the KEY distribution style.
+	DistKey string
+	SortKey []string
+	// COMPOUND, the default, or INTERLEAVED.
+	SortKeyStyle string
+}
+
+// Compression encodings a column can declare and the column types each works with, nil meaning any type.
+// https://docs.aws.amazon.com/redshift/latest/dg/c_Compression_encodings.html
+var columnEncodings = map[string][]string{
+	"raw":       nil,
+	"zstd":      nil,
+	"lz4":       nil,
+	"runlength": nil,
+	"lzo":       {"TEXT", "DECIMAL", "INTEGER", "DATE"},
+	"bytedict":  {"TEXT", "DECIMAL", "INTEGER", "DATE"},
+	"az64":      {"DECIMAL", "INTEGER", "DATE"},
+	"delta":     {"DECIMAL", "INTEGER", "DATE"},
+	"delta32k":  {"DECIMAL", "INTEGER", "DATE"},
+	"mostly8":   {"DECIMAL", "INTEGER"},
+	"mostly16":  {"DECIMAL", "INTEGER"},
+	"mostly32":  {"DECIMAL", "INTEGER"},
+	"text255":   {"TEXT"},
+	"text32k":   {"TEXT"},
+}
+
+// Checks the options only reference columns of layout and fills in the implied styles.
+func (o *tableOptions) validate(layout tableLayout) error {
+	columns := make(map[string]struct{}, len(layout.Columns)+len(layout.Metadata))
+	for _, col := range layout.Columns {
+		columns[col.Name] = struct{}{}
+	}
+	for _, name := range layout.Metadata {
+		columns[name] = struct{}{}
+	}
+
+	o.DistStyle = strings.ToUpper(o.DistStyle)
+	if o.DistKey != "" {
+		if o.DistStyle == "" {
+			o.DistStyle = distStyleKey
+		}
+		if o.DistStyle != distStyleKey {
+			return fmt.Errorf("distkey needs diststyle %s, got %s", distStyleKey, o.DistStyle)
+		}
+		if _, ok := columns[o.DistKey]; !ok {
+			return fmt.Errorf("distkey column %s is not defined", o.DistKey)
+		}
+	}
+	switch o.DistStyle {
+	case "", distStyleAuto, distStyleEven, distStyleAll:
+	case distStyleKey:
+		if o.DistKey == "" {
+			return fmt.Errorf("diststyle %s needs a distkey", distStyleKey)
+		}
+	default:
+		return fmt.Errorf("unknown diststyle %s", o.DistStyle)
+	}
+
+	o.SortKeyStyle = strings.ToUpper(o.SortKeyStyle)
+	if len(o.SortKey) == 0 {
+		if o.SortKeyStyle != "" {
+			return fmt.Errorf("sortkey_style set without a sortkey")
+		}
+		return nil
+	}
+	if o.SortKeyStyle == "" {
+		o.SortKeyStyle = sortKeyCompound
+	}
+	maxSortKeys := maxCompoundSortKeys
+	switch o.SortKeyStyle {
+	case sortKeyCompound:
+	case sortKeyInterleaved:
+		maxSortKeys = maxInterleavedSortKeys
+	default:
+		return fmt.Errorf("unknown sortkey_style %s", o.SortKeyStyle)
+	}
+	if len(o.SortKey) > maxSortKeys {
+		return fmt.Errorf("%s sortkey allows at most %d columns, got %d", strings.ToLower(o.SortKeyStyle), maxSortKeys, len(o.SortKey))
+	}
+	set := make(map[string]struct{}, len(o.SortKey))
+	for _, name := range o.SortKey {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("sortkey column %s is not defined", name)
+		}
+		if _, ok := set[name]; ok {
+			return fmt.Errorf("duplicate sortkey column %s", name)
+		}
+		set[name] = struct{}{}
+	}
+	return nil
+}
+
+// Renders the table attributes following the column definitions of CREATE TABLE, "" when there are none.
+func (o tableOptions) render() string {
+	var sb strings.Builder
+	if o.DistStyle != "" {
+		sb.WriteString(" DISTSTYLE " + o.DistStyle)
+	}
+	if o.DistKey != "" {
+		sb.WriteString(fmt.Sprintf(" DISTKEY(%s)", o.DistKey))
+	}
+	if len(o.SortKey) != 0 {
+		sb.WriteString(fmt.Sprintf(" %s SORTKEY(%s)", o.SortKeyStyle, strings.Join(o.SortKey, ", ")))
+	}
+	return sb.String()
+}
+
+// Checks the compression encoding declared for col exists and works with the type it has in the table.
+func validateColumnEncoding(col dBColumnSchema) error {
+	if col.Encode == "" {
+		return nil
+	}
+	types, ok := columnEncodings[col.Encode]
+	if !ok {
+		return fmt.Errorf("column %s: unknown encode %s", col.Name, col.Encode)
+	}
+	if types == nil {
+		return nil
+	}
+	valueType := col.DataType
+	if transformedType := transformedDataType(col); transformedType != "" {
+		valueType = transformedType
+	}
+	for _, t := range types {
+		if t == valueType {
+			return nil
+		}
+	}
+	return fmt.Errorf("column %s: encode %s does not support %s columns", col.Name, col.Encode, valueType)
+}
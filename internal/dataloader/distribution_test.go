@@ -0,0 +1,136 @@
+package dataloader
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestValidateTableOptions(t *testing.T) {
+	layout := tableLayout{
+		Table: "t",
+		Columns: []dBColumnSchema{
+			{Width: "10", Name: "account", DataType: "TEXT"},
+			{Width: "8", Name: "opened", DataType: "INTEGER"},
+		},
+		Metadata: []string{"file_date"},
+	}
+	tests := []struct {
+		name    string
+		options tableOptions
+		want    tableOptions
+		err     error
+	}{
+		{name: "none"},
+		{
+			name:    "distkey-implies-key",
+			options: tableOptions{DistKey: "account", SortKey: []string{"file_date", "opened"}},
+			want:    tableOptions{DistStyle: "KEY", DistKey: "account", SortKey: []string{"file_date", "opened"}, SortKeyStyle: "COMPOUND"},
+		},
+		{
+			name:    "lowercase-styles",
+			options: tableOptions{DistStyle: "even", SortKey: []string{"opened"}, SortKeyStyle: "interleaved"},
+			want:    tableOptions{DistStyle: "EVEN", SortKey: []string{"opened"}, SortKeyStyle: "INTERLEAVED"},
+		},
+		{name: "unknown-diststyle", options: tableOptions{DistStyle: "ROUND"}, err: errors.New("unknown diststyle ROUND")},
+		{name: "key-without-distkey", options: tableOptions{DistStyle: "KEY"}, err: errors.New("diststyle KEY needs a distkey")},
+		{
+			name:    "distkey-with-other-style",
+			options: tableOptions{DistStyle: "ALL", DistKey: "account"},
+			err:     errors.New("distkey needs diststyle KEY, got ALL"),
+		},
+		{name: "undefined-distkey", options: tableOptions{DistKey: "branch"}, err: errors.New("distkey column branch is not defined")},
+		{name: "undefined-sortkey", options: tableOptions{SortKey: []string{"branch"}}, err: errors.New("sortkey column branch is not defined")},
+		{
+			name:    "duplicate-sortkey",
+			options: tableOptions{SortKey: []string{"opened", "opened"}},
+			err:     errors.New("duplicate sortkey column opened"),
+		},
+		{
+			name:    "style-without-sortkey",
+			options: tableOptions{SortKeyStyle: "compound"},
+			err:     errors.New("sortkey_style set without a sortkey"),
+		},
+		{
+			name:    "unknown-sortkey-style",
+			options: tableOptions{SortKey: []string{"opened"}, SortKeyStyle: "zorder"},
+			err:     errors.New("unknown sortkey_style ZORDER"),
+		},
+		{
+			name: "too-many-interleaved",
+			options: tableOptions{
+				SortKey:      []string{"a", "b", "c", "d", "e", "f", "g", "h", "i"},
+				SortKeyStyle: "INTERLEAVED",
+			},
+			err: errors.New("interleaved sortkey allows at most 8 columns, got 9"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.validate(layout)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if err == nil && tt.want.render() != tt.options.render() {
+				t.Errorf("want: %+v, got: %+v", tt.want, tt.options)
+			}
+		})
+	}
+}
+
+func TestValidateColumnEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		col  dBColumnSchema
+		err  error
+	}{
+		{name: "none", col: dBColumnSchema{Name: "a", DataType: "BOOLEAN"}},
+		{name: "any-type", col: dBColumnSchema{Name: "a", DataType: "BOOLEAN", Encode: "zstd"}},
+		{name: "numeric", col: dBColumnSchema{Name: "a", DataType: "INTEGER", Encode: "az64"}},
+		{name: "transformed", col: dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"date:YYYYMMDD"}, Encode: "az64"}},
+		{name: "unknown", col: dBColumnSchema{Name: "a", DataType: "TEXT", Encode: "gzip"}, err: errors.New("column a: unknown encode gzip")},
+		{
+			name: "wrong-type",
+			col:  dBColumnSchema{Name: "a", DataType: "TEXT", Encode: "az64"},
+			err:  errors.New("column a: encode az64 does not support TEXT columns"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateColumnEncoding(tt.col)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestBuildCreateTableQueryWithOptions(t *testing.T) {
+	svc := &DataLoader{DataBucket: "testDB", Logger: log.NewNopLogger()}
+	layout := tableLayout{
+		Table: "testtable",
+		Columns: []dBColumnSchema{
+			{Width: "10", Name: "account", DataType: "TEXT", Encode: "zstd"},
+			{Width: "8", Name: "opened", DataType: "TEXT", Transforms: []string{"date:YYYYMMDD"}, Encode: "az64"},
+		},
+		Options: tableOptions{DistStyle: "KEY", DistKey: "account", SortKey: []string{"opened", "account"}, SortKeyStyle: "COMPOUND"},
+	}
+	got, err := svc.buildCreateTableQuery(layout)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "CREATE TABLE testtable( account VARCHAR(10) ENCODE ZSTD, opened DATE ENCODE AZ64) " +
+		"DISTSTYLE KEY DISTKEY(account) COMPOUND SORTKEY(opened, account);"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	got, err = svc.buildCreateStagingTableQuery("testtable_staging", layout.Columns, encodingUTF8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "CREATE TEMP TABLE testtable_staging( account VARCHAR(10), opened VARCHAR(8));"; want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
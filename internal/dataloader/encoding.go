@@ -0,0 +1,171 @@
+package dataloader
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Source encodings a schema can declare. Redshift COPY needs UTF-8, so files in any of these are transcoded into the
+// staged copy first.
+const (
+	encodingUTF8        = ""
+	encodingLatin1      = "latin1"
+	encodingWindows1252 = "windows-1252"
+	encodingEBCDIC      = "ebcdic"
+)
+
+// Alternative names accepted for each encoding.
+var encodingAliases = map[string]string{
+	"utf-8":        encodingUTF8,
+	"utf8":         encodingUTF8,
+	"latin1":       encodingLatin1,
+	"latin-1":      encodingLatin1,
+	"iso-8859-1":   encodingLatin1,
+	"windows-1252": encodingWindows1252,
+	"cp1252":       encodingWindows1252,
+	"ebcdic":       encodingEBCDIC,
+	"cp037":        encodingEBCDIC,
+}
+
+// Single byte encodings decode every byte to exactly one rune, so a table is all that is needed.
+type charset [256]rune
+
+var charsets = map[string]*charset{
+	encodingLatin1:      newLatin1(),
+	encodingWindows1252: newWindows1252(),
+	encodingEBCDIC:      &ebcdic037,
+}
+
+// Normalizes an encoding name from a schema, failing on ones the loader can't transcode.
+func parseEncoding(name string) (string, error) {
+	enc, ok := encodingAliases[strings.ToLower(name)]
+	if name != "" && !ok {
+		return "", fmt.Errorf("unsupported encoding %s", name)
+	}
+	return enc, nil
+}
+
+// Returns the most bytes a character of the passed encoding takes once transcoded to UTF-8, 1 for UTF-8 sources
+// whose field widths already count bytes.
+func maxUTF8Bytes(encoding string) int {
+	cs, ok := charsets[encoding]
+	if !ok {
+		return 1
+	}
+	most := 1
+	for _, r := range cs {
+		if n := utf8.RuneLen(r); n > most {
+			most = n
+		}
+	}
+	return most
+}
+
+// Wraps r so it reads as UTF-8 when it holds text in the passed encoding.
+func transcode(r io.Reader, encoding string) io.Reader {
+	cs, ok := charsets[encoding]
+	if !ok {
+		return r
+	}
+	return &transcodingReader{r: bufio.NewReader(r), charset: cs}
+}
+
+type transcodingReader struct {
+	r       *bufio.Reader
+	charset *charset
+	pending []byte
+	err     error
+}
+
+func (t *transcodingReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(t.pending) > 0 {
+			c := copy(p[n:], t.pending)
+			t.pending = t.pending[c:]
+			n += c
+			continue
+		}
+		if t.err != nil {
+			break
+		}
+		b, err := t.r.ReadByte()
+		if err != nil {
+			t.err = err
+			break
+		}
+		r := t.charset[b]
+		if r < utf8.RuneSelf {
+			p[n] = byte(r)
+			n++
+			continue
+		}
+		var buf [utf8.UTFMax]byte
+		t.pending = append(t.pending[:0], buf[:utf8.EncodeRune(buf[:], r)]...)
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, t.err
+}
+
+func newLatin1() *charset {
+	cs := &charset{}
+	for i := range cs {
+		cs[i] = rune(i)
+	}
+	return cs
+}
+
+// Windows-1252 is Latin-1 apart from printable characters in place of most C1 controls. The five bytes it leaves
+// undefined keep their Latin-1 meaning.
+func newWindows1252() *charset {
+	cs := newLatin1()
+	copy(cs[0x80:0xA0], []rune{
+		0x20AC, 0x0081, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, // 0x80
+		0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0x008D, 0x017D, 0x008F, // 0x88
+		0x0090, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, // 0x90
+		0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0x009D, 0x017E, 0x0178, // 0x98
+	})
+	return cs
+}
+
+// IBM code page 037, EBCDIC as used by US and Canadian mainframes. NEL (0x15) is decoded as a newline since that is
+// what ends records in these files.
+var ebcdic037 = charset{
+	0x0000, 0x0001, 0x0002, 0x0003, 0x009C, 0x0009, 0x0086, 0x007F, // 0x00
+	0x0097, 0x008D, 0x008E, 0x000B, 0x000C, 0x000D, 0x000E, 0x000F, // 0x08
+	0x0010, 0x0011, 0x0012, 0x0013, 0x009D, 0x000A, 0x0008, 0x0087, // 0x10
+	0x0018, 0x0019, 0x0092, 0x008F, 0x001C, 0x001D, 0x001E, 0x001F, // 0x18
+	0x0080, 0x0081, 0x0082, 0x0083, 0x0084, 0x000A, 0x0017, 0x001B, // 0x20
+	0x0088, 0x0089, 0x008A, 0x008B, 0x008C, 0x0005, 0x0006, 0x0007, // 0x28
+	0x0090, 0x0091, 0x0016, 0x0093, 0x0094, 0x0095, 0x0096, 0x0004, // 0x30
+	0x0098, 0x0099, 0x009A, 0x009B, 0x0014, 0x0015, 0x009E, 0x001A, // 0x38
+	0x0020, 0x00A0, 0x00E2, 0x00E4, 0x00E0, 0x00E1, 0x00E3, 0x00E5, // 0x40
+	0x00E7, 0x00F1, 0x00A2, 0x002E, 0x003C, 0x0028, 0x002B, 0x007C, // 0x48
+	0x0026, 0x00E9, 0x00EA, 0x00EB, 0x00E8, 0x00ED, 0x00EE, 0x00EF, // 0x50
+	0x00EC, 0x00DF, 0x0021, 0x0024, 0x002A, 0x0029, 0x003B, 0x00AC, // 0x58
+	0x002D, 0x002F, 0x00C2, 0x00C4, 0x00C0, 0x00C1, 0x00C3, 0x00C5, // 0x60
+	0x00C7, 0x00D1, 0x00A6, 0x002C, 0x0025, 0x005F, 0x003E, 0x003F, // 0x68
+	0x00F8, 0x00C9, 0x00CA, 0x00CB, 0x00C8, 0x00CD, 0x00CE, 0x00CF, // 0x70
+	0x00CC, 0x0060, 0x003A, 0x0023, 0x0040, 0x0027, 0x003D, 0x0022, // 0x78
+	0x00D8, 0x0061, 0x0062, 0x0063, 0x0064, 0x0065, 0x0066, 0x0067, // 0x80
+	0x0068, 0x0069, 0x00AB, 0x00BB, 0x00F0, 0x00FD, 0x00FE, 0x00B1, // 0x88
+	0x00B0, 0x006A, 0x006B, 0x006C, 0x006D, 0x006E, 0x006F, 0x0070, // 0x90
+	0x0071, 0x0072, 0x00AA, 0x00BA, 0x00E6, 0x00B8, 0x00C6, 0x00A4, // 0x98
+	0x00B5, 0x007E, 0x0073, 0x0074, 0x0075, 0x0076, 0x0077, 0x0078, // 0xA0
+	0x0079, 0x007A, 0x00A1, 0x00BF, 0x00D0, 0x00DD, 0x00DE, 0x00AE, // 0xA8
+	0x005E, 0x00A3, 0x00A5, 0x00B7, 0x00A9, 0x00A7, 0x00B6, 0x00BC, // 0xB0
+	0x00BD, 0x00BE, 0x005B, 0x005D, 0x00AF, 0x00A8, 0x00B4, 0x00D7, // 0xB8
+	0x007B, 0x0041, 0x0042, 0x0043, 0x0044, 0x0045, 0x0046, 0x0047, // 0xC0
+	0x0048, 0x0049, 0x00AD, 0x00F4, 0x00F6, 0x00F2, 0x00F3, 0x00F5, // 0xC8
+	0x007D, 0x004A, 0x004B, 0x004C, 0x004D, 0x004E, 0x004F, 0x0050, // 0xD0
+	0x0051, 0x0052, 0x00B9, 0x00FB, 0x00FC, 0x00F9, 0x00FA, 0x00FF, // 0xD8
+	0x005C, 0x00F7, 0x0053, 0x0054, 0x0055, 0x0056, 0x0057, 0x0058, // 0xE0
+	0x0059, 0x005A, 0x00B2, 0x00D4, 0x00D6, 0x00D2, 0x00D3, 0x00D5, // 0xE8
+	0x0030, 0x0031, 0x0032, 0x0033, 0x0034, 0x0035, 0x0036, 0x0037, // 0xF0
+	0x0038, 0x0039, 0x00B3, 0x00DB, 0x00DC, 0x00D9, 0x00DA, 0x009F, // 0xF8
+}
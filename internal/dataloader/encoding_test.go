@@ -0,0 +1,112 @@
+package dataloader
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		input    string
+		want     string
+	}{
+		{name: "utf-8-untouched", encoding: encodingUTF8, input: "café\n", want: "café\n"},
+		{name: "latin1", encoding: encodingLatin1, input: "caf\xe9 \xa3\n", want: "café £\n"},
+		{name: "windows-1252", encoding: encodingWindows1252, input: "\x80 \x93quoted\x94 caf\xe9", want: "€ “quoted” café"},
+		{name: "ebcdic", encoding: encodingEBCDIC, input: "\xc8\x85\x93\x93\x96\x40\xf1\xf2\x15\xe6\x96\x99\x93\x84\x25", want: "Hello 12\nWorld\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Read a byte at a time to exercise runes split across reads
+			got, err := ioutil.ReadAll(iotest.OneByteReader(transcode(strings.NewReader(tt.input), tt.encoding)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("want: %q, got: %q", tt.want, string(got))
+			}
+		})
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "", want: encodingUTF8},
+		{name: "UTF-8", want: encodingUTF8},
+		{name: "ISO-8859-1", want: encodingLatin1},
+		{name: "cp1252", want: encodingWindows1252},
+		{name: "EBCDIC", want: encodingEBCDIC},
+		{name: "shift-jis", err: errors.New("unsupported encoding shift-jis")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEncoding(tt.name)
+			if tt.err != nil {
+				if err == nil || tt.err.Error() != err.Error() {
+					t.Errorf("want: %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil || tt.want != got {
+				t.Errorf("want: %q, got: %q %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestVarcharSizedForTranscodedText(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		target   string
+		// A field filling the column's width with the widest characters of the encoding
+		field string
+		want  string
+	}{
+		{name: "utf-8", encoding: encodingUTF8, field: "abcd", want: "VARCHAR(4)"},
+		{name: "latin1", encoding: encodingLatin1, field: "\xe9\xe9\xe9\xe9", want: "VARCHAR(8)"},
+		{name: "windows-1252", encoding: encodingWindows1252, field: "\x80\x80\x80\x80", want: "VARCHAR(12)"},
+		{name: "ebcdic", encoding: encodingEBCDIC, field: "\x51\x51\x51\x51", want: "VARCHAR(8)"},
+		{name: "postgres-counts-characters", encoding: encodingWindows1252, target: TargetPostgres, field: "\x80\x80\x80\x80", want: "VARCHAR(4)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &DataLoader{Logger: log.NewNopLogger(), Target: tt.target}
+			query, err := svc.buildCreateTableQuery(tableLayout{
+				Table:    "t",
+				Columns:  []dBColumnSchema{{Width: "4", Name: "name", DataType: "TEXT"}},
+				Encoding: tt.encoding,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if want := fmt.Sprintf("CREATE TABLE t( name %s);", tt.want); query != want {
+				t.Errorf("want: %s, got: %s", want, query)
+			}
+			staging, err := svc.buildCreateStagingTableQuery("t_staging", []dBColumnSchema{{Width: "4", Name: "name", DataType: "TEXT"}}, tt.encoding)
+			if err != nil || !strings.Contains(staging, tt.want) {
+				t.Errorf("want staging table with %s, got: %s, %v", tt.want, staging, err)
+			}
+
+			transcoded, err := ioutil.ReadAll(transcode(strings.NewReader(tt.field), tt.encoding))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.target != TargetPostgres && fmt.Sprintf("VARCHAR(%d)", len(transcoded)) != tt.want {
+				t.Errorf("want the full field to fill %s exactly, got %d bytes", tt.want, len(transcoded))
+			}
+		})
+	}
+}
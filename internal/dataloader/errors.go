@@ -0,0 +1,225 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/smithy-go"
+	"github.com/lib/pq"
+)
+
+// SchemaError is a load failure caused by the table definition: a missing or invalid schema object, or an existing
+// table that doesn't match it. Retrying fails the same way until the definition is fixed.
+type SchemaError struct {
+	Err error
+}
+
+func (e *SchemaError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *SchemaError) Unwrap() error { return e.Err }
+
+// DataError is a load failure caused by the data file not matching its definition, e.g. short rows, unknown record
+// types, failed control totals or values the database rejects. Retrying fails the same way.
+type DataError struct {
+	Err error
+}
+
+func (e *DataError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *DataError) Unwrap() error { return e.Err }
+
+// TransientError is a load failure that may succeed when retried: lost connections, serialization conflicts,
+// throttling and timeouts.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// ConfigError is a load failure caused by how the loader is set up: missing permissions, rejected credentials or an
+// executor that can't serve the configured target. The data file is fine and can be loaded once the setup is fixed.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string { return e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *ConfigError) Unwrap() error { return e.Err }
+
+// IsTransient reports if a load failing with err may succeed when retried.
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// IsPermanent reports if a load failing with err fails the same way however often it is retried, because of its data
+// file or table definition.
+func IsPermanent(err error) bool {
+	if err == nil || IsTransient(err) {
+		return false
+	}
+	var (
+		schemaErr *SchemaError
+		dataErr   *DataError
+	)
+	return errors.As(err, &schemaErr) || errors.As(err, &dataErr)
+}
+
+// AWS error codes worth retrying.
+var transientAWSCodes = map[string]struct{}{
+	"RequestError":            {},
+	"RequestCanceled":         {},
+	"RequestTimeout":          {},
+	"RequestTimeoutException": {},
+	"Throttling":              {},
+	"ThrottlingException":     {},
+	"SlowDown":                {},
+	"InternalError":           {},
+	"InternalServerException": {},
+	"ServiceUnavailable":      {},
+	"ExpiredToken":            {},
+	// Data API limits on concurrent statements and sessions
+	"ActiveStatementsExceededException": {},
+	"ActiveSessionsExceededException":   {},
+}
+
+// AWS error codes of requests the loader isn't allowed to make.
+var configAWSCodes = map[string]struct{}{
+	"AccessDenied":          {},
+	"AccessDeniedException": {},
+	"InvalidAccessKeyId":    {},
+	"NoSuchBucket":          {},
+}
+
+// SQLSTATEs of a CREATE losing a race with a concurrent load creating the same schema or table. The catalog check
+// before it saw nothing, so the retried transaction finds the object and skips creating it.
+var createRaceCodes = map[pq.ErrorCode]struct{}{
+	"42P06": {}, // duplicate_schema
+	"42P07": {}, // duplicate_table
+	"23505": {}, // unique_violation, on the catalog's unique type name index
+}
+
+// Marks err from a CREATE statement transient when it lost a race with a concurrent one, which would otherwise be
+// classified as a schema or data error and quarantine a valid file.
+func classifyCreateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if _, ok := createRaceCodes[pqErr.Code]; ok {
+			return &TransientError{err}
+		}
+	}
+	return err
+}
+
+// Classifies err from what caused it, leaving errors already classified as they are. Errors in the chain of a schema
+// or data error that are transient, like a connection lost while reading the file, make the whole error transient.
+// Errors that can't be told apart are returned unchanged.
+func classifyError(err error) error {
+	if err == nil || IsTransient(err) {
+		return err
+	}
+	if isTransientCause(err) {
+		return &TransientError{err}
+	}
+	var (
+		schemaErr *SchemaError
+		dataErr   *DataError
+		configErr *ConfigError
+	)
+	if errors.As(err, &schemaErr) || errors.As(err, &dataErr) || errors.As(err, &configErr) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "28" || pqErr.Code == "42501" || pqErr.Code == "3D000":
+			// Rejected login, missing privilege or database
+			return &ConfigError{err}
+		case pqErr.Code.Class() == "42":
+			// Undefined or mismatched columns, tables and types
+			return &SchemaError{err}
+		case pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23":
+			return &DataError{err}
+		case strings.Contains(pqErr.Message, "stl_load_errors"):
+			// Redshift COPY rejecting rows
+			return &DataError{err}
+		}
+	}
+	if code := awsErrorCode(err); code != "" {
+		if _, ok := configAWSCodes[code]; ok {
+			return &ConfigError{err}
+		}
+	}
+	return err
+}
+
+// Reports if anything in the chain of err is known to be worth retrying.
+func isTransientCause(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08", "40", "53", "57":
+			// Connection exceptions, serialization failures and deadlocks, insufficient resources, shutdowns
+			return true
+		}
+		return pqErr.Code == "55P03"
+	}
+	if aerr := findAWSError(err); aerr != nil {
+		if _, ok := transientAWSCodes[aerr.Code()]; ok {
+			return true
+		}
+		if rerr, ok := aerr.(awserr.RequestFailure); ok && rerr.StatusCode() >= 500 {
+			return true
+		}
+		// AWS errors don't unwrap, their cause is kept separately
+		return aerr.OrigErr() != nil && isTransientCause(aerr.OrigErr())
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		_, ok := transientAWSCodes[apiErr.ErrorCode()]
+		return ok || apiErr.ErrorFault() == smithy.FaultServer
+	}
+	return false
+}
+
+// Returns the error code of the first AWS error in the chain of err, from either SDK, empty if there is none.
+func awsErrorCode(err error) string {
+	if aerr := findAWSError(err); aerr != nil {
+		return aerr.Code()
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// Returns the first AWS error in the chain of err, nil if there is none.
+func findAWSError(err error) awserr.Error {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if aerr, ok := err.(awserr.Error); ok {
+			return aerr
+		}
+	}
+	return nil
+}
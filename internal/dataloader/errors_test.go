@@ -0,0 +1,138 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/smithy-go"
+	"github.com/go-kit/kit/log"
+	"github.com/lib/pq"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      interface{}
+		permanent bool
+	}{
+		{name: "unknown", err: errors.New("boom")},
+		{name: "schema", err: &SchemaError{errors.New("unknown data type passed FLOAT")}, kind: &SchemaError{}, permanent: true},
+		{name: "data", err: &DataError{errors.New("row 3 too short")}, kind: &DataError{}, permanent: true},
+		{name: "config", err: &ConfigError{errors.New("no copy in")}, kind: &ConfigError{}},
+		{name: "bad-conn", err: driver.ErrBadConn, kind: &TransientError{}},
+		{name: "deadline", err: fmt.Errorf("copy: %w", context.DeadlineExceeded), kind: &TransientError{}},
+		{name: "serialization", err: &pq.Error{Code: "40001"}, kind: &TransientError{}},
+		{name: "connection", err: &pq.Error{Code: "08006"}, kind: &TransientError{}},
+		{name: "login", err: &pq.Error{Code: "28P01"}, kind: &ConfigError{}},
+		{name: "privilege", err: &pq.Error{Code: "42501"}, kind: &ConfigError{}},
+		{name: "undefined-column", err: &pq.Error{Code: "42703"}, kind: &SchemaError{}, permanent: true},
+		{name: "invalid-value", err: &pq.Error{Code: "22P02"}, kind: &DataError{}, permanent: true},
+		{name: "redshift-load-error", err: &pq.Error{Code: "XX000", Message: "Load into table 't' failed.  Check 'stl_load_errors' system table for details."},
+			kind: &DataError{}, permanent: true},
+		{name: "throttled", err: awserr.New("SlowDown", "Please reduce your request rate.", nil), kind: &TransientError{}},
+		{name: "access-denied", err: awserr.New("AccessDenied", "Access Denied", nil), kind: &ConfigError{}},
+		{name: "data-read-failed", err: &DataError{awserr.New("RequestError", "read failed", nil)}, kind: &TransientError{}},
+		{name: "v2-throttled", err: &smithy.GenericAPIError{Code: "ActiveStatementsExceededException"}, kind: &TransientError{}},
+		{name: "v2-server-fault", err: &smithy.GenericAPIError{Code: "InternalServerError", Fault: smithy.FaultServer}, kind: &TransientError{}},
+		{name: "v2-access-denied", err: fmt.Errorf("execute: %w", &smithy.GenericAPIError{Code: "AccessDeniedException"}), kind: &ConfigError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyError(tt.err)
+			if got.Error() != tt.err.Error() {
+				t.Errorf("want message: %s, got: %s", tt.err, got)
+			}
+			var kind interface{}
+			var (
+				schemaErr    *SchemaError
+				dataErr      *DataError
+				transientErr *TransientError
+				configErr    *ConfigError
+			)
+			switch {
+			case errors.As(got, &transientErr):
+				kind = &TransientError{}
+			case errors.As(got, &schemaErr):
+				kind = &SchemaError{}
+			case errors.As(got, &dataErr):
+				kind = &DataError{}
+			case errors.As(got, &configErr):
+				kind = &ConfigError{}
+			}
+			if fmt.Sprintf("%T", tt.kind) != fmt.Sprintf("%T", kind) {
+				t.Errorf("want: %T, got: %T", tt.kind, kind)
+			}
+			if IsPermanent(got) != tt.permanent {
+				t.Errorf("want permanent: %v, got: %v", tt.permanent, IsPermanent(got))
+			}
+		})
+	}
+}
+
+func TestLoadErrorsClassified(t *testing.T) {
+	svc := &DataLoader{
+		DB:           &recordingExecutor{},
+		Logger:       log.NewNopLogger(),
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc:        newFakeS3("testDB", map[string]string{"testformat1_2015-06-28.txt": "Foonyor   1  1\n"}),
+	}
+	_, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+	var schemaErr *SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Errorf("want: a SchemaError for a missing definition, got: %#v", err)
+	}
+}
+
+func TestDatabaseKeyIsConfigError(t *testing.T) {
+	svc := &DataLoader{
+		DB:           &recordingExecutor{},
+		Logger:       log.NewNopLogger(),
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc: newFakeS3("testSchemas", map[string]string{
+			"testformat1.json": `{"database": "vendor_x", "columns": [{"name": "name", "width": 10, "datatype": "TEXT"}]}`,
+		}),
+	}
+	_, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+	var configErr *ConfigError
+	var schemaErr *SchemaError
+	if !errors.As(err, &configErr) || errors.As(err, &schemaErr) {
+		t.Errorf("want: a ConfigError for a database key, got: %#v", err)
+	}
+}
+
+func TestCreateRaceTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		statement string
+		err       error
+		transient bool
+	}{
+		{name: "duplicate-table", statement: "CREATE TABLE", err: &pq.Error{Code: "42P07"}, transient: true},
+		{name: "duplicate-type", statement: "CREATE TABLE", err: &pq.Error{Code: "23505"}, transient: true},
+		{name: "duplicate-schema", statement: "CREATE SCHEMA", err: &pq.Error{Code: "42P06"}, transient: true},
+		{name: "undefined-type", statement: "CREATE TABLE", err: &pq.Error{Code: "42704"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &DataLoader{Logger: log.NewNopLogger(), DB: &recordingExecutor{errs: map[string]error{tt.statement: tt.err}}}
+			tx, _ := svc.DB.BeginTx(context.Background())
+			err := svc.createSchemaIfMissing(context.Background(), tx, "raw")
+			if err == nil {
+				err = svc.createTable(context.Background(), tx, tableLayout{Table: "t", Columns: []dBColumnSchema{{Width: "1", Name: "a", DataType: "TEXT"}}})
+			}
+			if err == nil {
+				t.Fatal("want an error")
+			}
+			if got := IsTransient(classifyError(err)); got != tt.transient {
+				t.Errorf("want transient: %v, got: %v for %v", tt.transient, got, err)
+			}
+		})
+	}
+}
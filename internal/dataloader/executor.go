@@ -0,0 +1,137 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql"
+	"io"
+
+	"github.com/lib/pq"
+)
+
+// Executor runs the SQL of loads against the database. NewSQLExecutor adapts a database/sql connection pool, other
+// implementations run the same statements through other means, e.g. the Redshift Data API.
+type Executor interface {
+	Queryer
+	BeginTx(ctx context.Context) (Tx, error)
+}
+
+// Tx is a transaction started by an Executor.
+type Tx interface {
+	Queryer
+	Commit() error
+	Rollback() error
+}
+
+// Queryer runs statements, taking arguments as $1, $2, ... placeholders.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) Row
+}
+
+// Rows is the result of a query, read the same way as *sql.Rows.
+type Rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// Row is the result of a query expected to return a single row, read the same way as *sql.Row.
+type Row interface {
+	Scan(dest ...interface{}) error
+}
+
+// NewSQLExecutor returns an Executor running statements on connections of db.
+func NewSQLExecutor(db *sql.DB) Executor {
+	return sqlExecutor{db}
+}
+
+type sqlExecutor struct {
+	db *sql.DB
+}
+
+func (e sqlExecutor) BeginTx(ctx context.Context) (Tx, error) {
+	tx, err := e.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sqlTx{tx}, nil
+}
+
+func (e sqlExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return e.db.ExecContext(ctx, query, args...)
+}
+
+func (e sqlExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	rows, err := e.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (e sqlExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	return e.db.QueryRowContext(ctx, query, args...)
+}
+
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func (t sqlTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, query, args...)
+}
+
+func (t sqlTx) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	rows, err := t.tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (t sqlTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	return t.tx.QueryRowContext(ctx, query, args...)
+}
+
+// Streams the rows next returns into a lib/pq COPY FROM STDIN of the table.
+func (t sqlTx) copyIn(ctx context.Context, schemaName, tableName string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	copyQuery := pq.CopyIn(tableName, columns...)
+	if schemaName != "" {
+		copyQuery = pq.CopyInSchema(schemaName, tableName, columns...)
+	}
+	stmt, err := t.tx.PrepareContext(ctx, copyQuery)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var copied int64
+	for {
+		values, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if _, err = stmt.ExecContext(ctx, values...); err != nil {
+			return 0, err
+		}
+		copied++
+	}
+	// Executing without values flushes the buffered rows
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
@@ -0,0 +1,270 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// recordingExecutor is an in-memory Executor recording every statement it runs, transaction control included as
+// BEGIN, COMMIT and ROLLBACK. Statements starting with a key of errs fail with its error, queries starting with a key
+// of rows return its rows, unless answer returns rows for them first. Other statements succeed and queries return no
+// rows. Rows COPYed from STDIN are kept in copied by table.
+type recordingExecutor struct {
+	statements []string
+	// Arguments passed with each statement
+	args   [][]interface{}
+	answer func(query string) [][]interface{}
+	rows   map[string][][]interface{}
+	errs   map[string]error
+	copied map[string][][]interface{}
+}
+
+func (e *recordingExecutor) BeginTx(ctx context.Context) (Tx, error) {
+	if err := e.record("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &recordingTx{recordingExecutor: e}, nil
+}
+
+func (e *recordingExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := e.record(query, args); err != nil {
+		return nil, err
+	}
+	return recordedResult(0), nil
+}
+
+func (e *recordingExecutor) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	if err := e.record(query, args); err != nil {
+		return nil, err
+	}
+	if e.answer != nil {
+		if rows := e.answer(query); rows != nil {
+			return &recordedRows{rows: rows}, nil
+		}
+	}
+	for prefix, rows := range e.rows {
+		if strings.HasPrefix(query, prefix) {
+			return &recordedRows{rows: rows}, nil
+		}
+	}
+	return &recordedRows{}, nil
+}
+
+func (e *recordingExecutor) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	rows, err := e.QueryContext(ctx, query, args...)
+	return &recordedRow{rows: rows, err: err}
+}
+
+func (e *recordingExecutor) record(query string, args []interface{}) error {
+	e.statements = append(e.statements, query)
+	e.args = append(e.args, args)
+	for prefix, err := range e.errs {
+		if strings.HasPrefix(query, prefix) {
+			return err
+		}
+	}
+	return nil
+}
+
+type recordingTx struct {
+	*recordingExecutor
+	done bool
+}
+
+func (t *recordingTx) Commit() error {
+	return t.finish("COMMIT")
+}
+
+func (t *recordingTx) Rollback() error {
+	return t.finish("ROLLBACK")
+}
+
+func (t *recordingTx) finish(statement string) error {
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	return t.record(statement, nil)
+}
+
+func (t *recordingTx) copyIn(ctx context.Context, schemaName, tableName string, columns []string, next func() ([]interface{}, error)) (int64, error) {
+	table := qualifiedTableName(schemaName, tableName)
+	if err := t.record(fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(columns, ", ")), nil); err != nil {
+		return 0, err
+	}
+	if t.copied == nil {
+		t.copied = make(map[string][][]interface{})
+	}
+	var copied int64
+	for {
+		values, err := next()
+		if err == io.EOF {
+			return copied, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		t.copied[table] = append(t.copied[table], values)
+		copied++
+	}
+}
+
+// recordedResult is the sql.Result of a recorded statement, affecting that many rows.
+type recordedResult int64
+
+func (r recordedResult) LastInsertId() (int64, error) { return 0, errors.New("no insert ID") }
+func (r recordedResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+type recordedRows struct {
+	rows    [][]interface{}
+	current []interface{}
+}
+
+func (r *recordedRows) Next() bool {
+	if len(r.rows) == 0 {
+		return false
+	}
+	r.current, r.rows = r.rows[0], r.rows[1:]
+	return true
+}
+
+func (r *recordedRows) Scan(dest ...interface{}) error {
+	if len(dest) != len(r.current) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(r.current), len(dest))
+	}
+	for i, value := range r.current {
+		if scanner, ok := dest[i].(sql.Scanner); ok {
+			if err := scanner.Scan(value); err != nil {
+				return err
+			}
+			continue
+		}
+		target := reflect.ValueOf(dest[i]).Elem()
+		target.Set(reflect.ValueOf(value).Convert(target.Type()))
+	}
+	return nil
+}
+
+func (r *recordedRows) Err() error {
+	return nil
+}
+
+func (r *recordedRows) Close() error {
+	return nil
+}
+
+type recordedRow struct {
+	rows Rows
+	err  error
+}
+
+func (r *recordedRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if !r.rows.Next() {
+		return sql.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+// Checks got are the statements in want, each statement of want standing for any starting with it.
+func assertStatements(t *testing.T, want, got []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("want: %q, got: %q", want, got)
+		return
+	}
+	for i, statement := range got {
+		if !strings.HasPrefix(statement, want[i]) {
+			t.Errorf("statement %d, want: %s, got: %s", i, want[i], statement)
+		}
+	}
+}
+
+func TestSQLExecutor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	executor := NewSQLExecutor(db)
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE t( a INTEGER);")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a FROM t WHERE a = $1;")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_last_copy_count();")).
+		WillReturnError(errors.New("query failed"))
+	mock.ExpectCommit()
+
+	tx, err := executor.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "CREATE TABLE t( a INTEGER);"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var a int
+	if err := tx.QueryRowContext(ctx, "SELECT a FROM t WHERE a = $1;", 1).Scan(&a); err != nil || a != 1 {
+		t.Errorf("want: 1, got: %d (%v)", a, err)
+	}
+	if _, err := tx.QueryContext(ctx, "SELECT pg_last_copy_count();"); err == nil {
+		t.Errorf("want: query failed, got: nil")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet sql expectations: %v", err)
+	}
+}
+
+func TestSQLExecutorCopyIn(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	prepared := mock.ExpectPrepare(regexp.QuoteMeta(`COPY "raw_vendor_x"."t" ("a", "b") FROM STDIN`))
+	prepared.ExpectExec().WithArgs("1", "x").WillReturnResult(sqlmock.NewResult(0, 0))
+	prepared.ExpectExec().WithArgs("2", "y").WillReturnResult(sqlmock.NewResult(0, 0))
+	prepared.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	tx, err := NewSQLExecutor(db).BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rows := [][]interface{}{{"1", "x"}, {"2", "y"}}
+	copied, err := tx.(copyInTx).copyIn(ctx, "raw_vendor_x", "t", []string{"a", "b"}, func() ([]interface{}, error) {
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	})
+	if err != nil || copied != 2 {
+		t.Errorf("want: 2, got: %d (%v)", copied, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet sql expectations: %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package dataloader
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ellery44/data-loader/internal/s3test"
+	"github.com/go-kit/kit/log"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the SQL generated")
+
+const (
+	goldenDir  = "testdata/golden"
+	goldenFile = "expected.sql"
+)
+
+// Matches the s3 key of a COPY statement.
+var copyKeyPattern = regexp.MustCompile(`^COPY \S+ FROM 's3://[^/]+/([^']+)'`)
+
+// TestGoldenSQL loads every case directory under testdata/golden and compares the statements run with the case's
+// expected.sql. A case holds the schema object(s) of its target and one data file, named the way files are uploaded,
+// e.g. orders.json and orders_2015-06-28.txt. Statement arguments follow their statement as "-- $n =" comments, a
+// load failing ends the expected SQL with an "-- error:" line. Run
+// go test -run TestGoldenSQL -update to rewrite the expected SQL after changing what the loader generates.
+func TestGoldenSQL(t *testing.T) {
+	cases, err := ioutil.ReadDir(goldenDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range cases {
+		if !c.IsDir() {
+			continue
+		}
+		dir := filepath.Join(goldenDir, c.Name())
+		t.Run(c.Name(), func(t *testing.T) {
+			got := runGoldenCase(t, dir)
+
+			path := filepath.Join(dir, goldenFile)
+			if *update {
+				if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v, run with -update to create it", err)
+			}
+			if string(want) != got {
+				t.Errorf("generated SQL differs from %s, run with -update if this is intended\nwant:\n%s\ngot:\n%s", path, want, got)
+			}
+		})
+	}
+}
+
+// Loads the data file of the case directory and returns the statements run, one per line.
+func runGoldenCase(t *testing.T, dir string) string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var dataFile string
+	for _, f := range files {
+		switch filepath.Ext(f.Name()) {
+		case ".json", ".csv", ".sql":
+		default:
+			dataFile = f.Name()
+		}
+	}
+	if dataFile == "" {
+		t.Fatalf("no data file in %s", dir)
+	}
+
+	s3Svc := &s3test.Fake{}
+	for _, bucket := range []string{"testSchemas", "testDB"} {
+		if err := s3Svc.LoadDir(bucket, dir); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	db := &recordingExecutor{}
+	// COPY loads every record of the object it reads
+	db.answer = func(query string) [][]interface{} {
+		if query != "SELECT pg_last_copy_count();" {
+			return nil
+		}
+		for i := len(db.statements) - 1; i >= 0; i-- {
+			if match := copyKeyPattern.FindStringSubmatch(db.statements[i]); match != nil {
+				body, _ := s3Svc.Object("testDB", match[1])
+				rows, _ := countRecords(strings.NewReader(body))
+				return [][]interface{}{{rows}}
+			}
+		}
+		return nil
+	}
+	svc := &DataLoader{
+		DB:           db,
+		Logger:       log.NewNopLogger(),
+		Env:          "test",
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc:        s3Svc,
+		now:          func() time.Time { return time.Date(2018, 11, 15, 10, 30, 0, 0, time.UTC) },
+		loadID:       func() string { return "0123456789abcdef0123456789abcdef" },
+	}
+
+	_, err = svc.LoadDataFileToRedshift(context.Background(), dataFile)
+	var sb strings.Builder
+	for i, statement := range db.statements {
+		sb.WriteString(statement)
+		for n, arg := range db.args[i] {
+			sb.WriteString(fmt.Sprintf(" -- $%d = %q", n+1, arg))
+		}
+		sb.WriteString("\n")
+	}
+	got := sb.String()
+	if err != nil {
+		got += fmt.Sprintf("-- error: %v\n", err)
+	}
+	if leftover := stagedKeys(s3Svc); len(leftover) != 0 {
+		t.Errorf("staged objects left behind: %q", leftover)
+	}
+	return got
+}
+
+func stagedKeys(s3Svc *s3test.Fake) []string {
+	var keys []string
+	for _, key := range s3Svc.Keys("testDB") {
+		if strings.HasPrefix(key, StagingPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
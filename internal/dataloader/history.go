@@ -0,0 +1,284 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// DefaultHistoryTable is the load history table of deployed loaders.
+const DefaultHistoryTable = "data_loader.load_history"
+
+// Statuses of loads in the history table.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Longest error text kept in the history table, in bytes.
+const maxHistoryErrorLength = 4096
+
+// How long recording a load in the history table may take. The write gets its own deadline since the load's context
+// may be what failed it.
+const historyWriteTimeout = 10 * time.Second
+
+// Columns of the history table in the order entries are written and read.
+const historyColumns = "load_id, file_key, table_name, mode, source_rows, rows_loaded, rows_rejected, bytes, " +
+	"schema_version, started_at, duration_ms, status, error_class, error_text"
+
+// HistoryEntry is a row of the load history table: what one load of a data file did to one of its tables. Loads
+// failing before their tables are known have a single entry for the target table named by the file.
+type HistoryEntry struct {
+	LoadID        string        `json:"load_id"`
+	Key           string        `json:"key"`
+	Table         string        `json:"table"`
+	Mode          string        `json:"mode,omitempty"`
+	SourceRows    int64         `json:"source_rows"`
+	RowsLoaded    int64         `json:"rows_loaded"`
+	RowsRejected  int64         `json:"rows_rejected"`
+	Bytes         int64         `json:"bytes"`
+	SchemaVersion string        `json:"schema_version,omitempty"`
+	StartedAt     time.Time     `json:"started_at"`
+	Duration      time.Duration `json:"duration"`
+	// StatusSucceeded or StatusFailed.
+	Status string `json:"status"`
+	// Class and message of the error failing the load, see ErrorClass.
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// HistoryFilter selects entries of the load history table. Fields left zero match every entry.
+type HistoryFilter struct {
+	// Table loaded into, qualified with its schema if it has one.
+	Table string
+	// Loads started at or after From and before To.
+	From time.Time
+	To   time.Time
+	// StatusSucceeded or StatusFailed.
+	Status string
+	// Most recent entries returned at most, all of them when 0.
+	Limit int
+}
+
+// LoadHistory returns the entries of the load history table matching filter, most recent first.
+func (d *DataLoader) LoadHistory(ctx context.Context, filter HistoryFilter) ([]HistoryEntry, error) {
+	if err := validateHistoryTable(d.HistoryTable); err != nil {
+		return nil, err
+	}
+	query, args := buildHistoryQuery(d.HistoryTable, filter)
+	rows, err := d.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []HistoryEntry
+	for rows.Next() {
+		var (
+			entry                                      HistoryEntry
+			mode, schemaVersion, errorClass, errorText sql.NullString
+			startedAt                                  historyTime
+			durationMillis                             int64
+		)
+		err = rows.Scan(&entry.LoadID, &entry.Key, &entry.Table, &mode, &entry.SourceRows, &entry.RowsLoaded,
+			&entry.RowsRejected, &entry.Bytes, &schemaVersion, &startedAt, &durationMillis, &entry.Status, &errorClass,
+			&errorText)
+		if err != nil {
+			return nil, err
+		}
+		entry.Mode, entry.SchemaVersion = mode.String, schemaVersion.String
+		entry.ErrorClass, entry.Error = errorClass.String, errorText.String
+		entry.StartedAt = time.Time(startedAt)
+		entry.Duration = time.Duration(durationMillis) * time.Millisecond
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Builds the query selecting the entries of historyTable matching filter and its arguments.
+func buildHistoryQuery(historyTable string, filter HistoryFilter) (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Table != "" {
+		where("table_name = $%d", filter.Table)
+	}
+	if !filter.From.IsZero() {
+		where("started_at >= $%d", filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		where("started_at < $%d", filter.To.UTC())
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("SELECT %s FROM %s", historyColumns, historyTable))
+	if len(conditions) != 0 {
+		sb.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	sb.WriteString(" ORDER BY started_at DESC, table_name")
+	if filter.Limit > 0 {
+		sb.WriteString(fmt.Sprintf(" LIMIT %d", filter.Limit))
+	}
+	sb.WriteString(";")
+	return sb.String(), args
+}
+
+// EnsureHistoryTable creates d.HistoryTable and its schema unless they exist. Loads only insert into the table, so
+// this has to run once before them, e.g. when the process starts.
+func (d *DataLoader) EnsureHistoryTable(ctx context.Context) error {
+	if err := validateHistoryTable(d.HistoryTable); err != nil {
+		return err
+	}
+	schemaName := ""
+	if i := strings.Index(d.HistoryTable, "."); i >= 0 {
+		schemaName = d.HistoryTable[:i]
+	}
+	return d.withRetry(ctx, "create history table", func() error {
+		if err := d.createSchemaIfMissing(ctx, d.DB, schemaName); err != nil {
+			return err
+		}
+		_, err := d.DB.ExecContext(ctx, buildCreateHistoryTableQuery(d.HistoryTable))
+		return classifyCreateError(err)
+	})
+}
+
+// Writes the entries of a load into d.HistoryTable, see EnsureHistoryTable. The write runs after the load's
+// transaction so failed loads are recorded too, including those failed by their context being done. Failures are
+// only logged since the load itself is already decided.
+func (d *DataLoader) recordHistory(result *LoadResult, loadErr error) {
+	if d.HistoryTable == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), historyWriteTimeout)
+	defer cancel()
+	entries := historyEntries(result, loadErr)
+	err := validateHistoryTable(d.HistoryTable)
+	if err == nil {
+		query, args := buildInsertHistoryQuery(d.HistoryTable, entries)
+		err = d.withRetry(ctx, "record history", func() error {
+			_, err := d.DB.ExecContext(ctx, query, args...)
+			return err
+		})
+	}
+	if err != nil {
+		level.Warn(d.Logger).Log("msg", "failed to record load history", "history_table", d.HistoryTable, "err", err)
+	}
+}
+
+// Returns the history entries describing a load, one per table it loaded into.
+func historyEntries(result *LoadResult, err error) []HistoryEntry {
+	base := HistoryEntry{
+		LoadID:        result.LoadID,
+		Key:           result.Key,
+		Table:         result.Target,
+		Bytes:         result.Bytes,
+		SchemaVersion: result.SchemaVersion,
+		StartedAt:     result.StartedAt,
+		Duration:      result.Durations.Total,
+		Status:        StatusSucceeded,
+	}
+	if err != nil {
+		base.Status, base.ErrorClass, base.Error = StatusFailed, ErrorClass(err), truncateUTF8(err.Error(), maxHistoryErrorLength)
+	}
+	if len(result.Tables) == 0 {
+		return []HistoryEntry{base}
+	}
+	entries := make([]HistoryEntry, 0, len(result.Tables))
+	for _, table := range result.Tables {
+		entry := base
+		entry.Table, entry.Mode = table.Table, table.Mode
+		entry.SourceRows, entry.RowsLoaded, entry.RowsRejected = table.SourceRows, table.RowsLoaded, table.RowsRejected
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func buildCreateHistoryTableQuery(historyTable string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s(load_id VARCHAR(32), file_key VARCHAR(1024), "+
+		"table_name VARCHAR(256), mode VARCHAR(16), source_rows BIGINT, rows_loaded BIGINT, rows_rejected BIGINT, "+
+		"bytes BIGINT, schema_version VARCHAR(64), started_at TIMESTAMP, duration_ms BIGINT, status VARCHAR(16), "+
+		"error_class VARCHAR(16), error_text VARCHAR(%d));", historyTable, maxHistoryErrorLength)
+}
+
+// Builds the INSERT writing entries into historyTable and its arguments. Empty optional values are written as NULL.
+func buildInsertHistoryQuery(historyTable string, entries []HistoryEntry) (string, []interface{}) {
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	var (
+		values []string
+		args   []interface{}
+	)
+	for _, entry := range entries {
+		row := []interface{}{entry.LoadID, entry.Key, entry.Table, nullable(entry.Mode), entry.SourceRows,
+			entry.RowsLoaded, entry.RowsRejected, entry.Bytes, nullable(entry.SchemaVersion), entry.StartedAt.UTC(),
+			int64(entry.Duration / time.Millisecond), entry.Status, nullable(entry.ErrorClass), nullable(entry.Error)}
+		placeholders := make([]string, len(row))
+		for i := range row {
+			placeholders[i] = fmt.Sprintf("$%d", len(args)+i+1)
+		}
+		args = append(args, row...)
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;", historyTable, historyColumns, strings.Join(values, ", ")), args
+}
+
+// Checks the history table name, optionally qualified with its schema, can be used unquoted in SQL.
+func validateHistoryTable(name string) error {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return &ConfigError{fmt.Errorf("invalid history table %q", name)}
+	}
+	for _, part := range parts {
+		if !identifierPattern.MatchString(part) {
+			return &ConfigError{fmt.Errorf("invalid history table %q", name)}
+		}
+	}
+	return nil
+}
+
+// Cuts s down to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// historyTime scans TIMESTAMP columns, read as time.Time over connections and as text through the Data API.
+type historyTime time.Time
+
+func (t *historyTime) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case time.Time:
+		*t = historyTime(v.UTC())
+		return nil
+	case string:
+		parsed, err := time.Parse("2006-01-02 15:04:05.999999", v)
+		if err != nil {
+			return err
+		}
+		*t = historyTime(parsed)
+		return nil
+	}
+	return fmt.Errorf("converting %T to a timestamp is unsupported", value)
+}
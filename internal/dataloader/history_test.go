@@ -0,0 +1,206 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestRecordHistory(t *testing.T) {
+	startedAt := time.Date(2018, 11, 15, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		schema string
+		want   [][]interface{}
+	}{
+		{
+			name:   "succeeded",
+			schema: "name,width,datatype\nname,10,TEXT\n",
+			want: [][]interface{}{{"0123456789abcdef0123456789abcdef", "testformat1_2015-06-28.txt", "testformat1",
+				LoadModeDirect, int64(1), int64(1), int64(0), int64(11), "schema-etag", startedAt, StatusSucceeded, nil, nil}},
+		},
+		{
+			name: "failed-without-definition",
+			want: [][]interface{}{{"", "testformat1_2015-06-28.txt", "testformat1", nil, int64(0), int64(0), int64(0),
+				int64(0), nil, startedAt, StatusFailed, ErrorClassSchema, "NoSuchKey: The specified key does not exist."}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &recordingExecutor{rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{int64(1)}}}}
+			s3Svc := newFakeS3("testDB", map[string]string{"testformat1_2015-06-28.txt": "Foonyor   \n"})
+			if tt.schema != "" {
+				s3Svc.Put("testSchemas", "testformat1.csv", tt.schema)
+			}
+			svc := &DataLoader{
+				DB:           db,
+				Logger:       log.NewNopLogger(),
+				DataBucket:   "testDB",
+				SchemaBucket: "testSchemas",
+				S3Svc:        s3Svc,
+				HistoryTable: DefaultHistoryTable,
+				now:          func() time.Time { return startedAt },
+				loadID:       func() string { return "0123456789abcdef0123456789abcdef" },
+			}
+			svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+
+			n := len(db.statements)
+			if n < 1 {
+				t.Fatalf("want: the history written, got: %q", db.statements)
+			}
+			assertStatements(t, []string{
+				"INSERT INTO data_loader.load_history (" + historyColumns + ") VALUES ($1, $2,",
+			}, db.statements[n-1:])
+			for _, statement := range db.statements {
+				if strings.HasPrefix(statement, "CREATE SCHEMA") || strings.Contains(statement, "load_history(") {
+					t.Errorf("want the history table left to EnsureHistoryTable, got: %s", statement)
+				}
+			}
+
+			args := db.args[n-1]
+			if len(args) != 14 {
+				t.Fatalf("want: 14 arguments, got: %v", args)
+			}
+			// Leave out the duration, which depends on the run
+			got := append(append([]interface{}{}, args[:10]...), args[11:]...)
+			if schemaVersion, _ := got[8].(string); schemaVersion != "" {
+				got[8] = "schema-etag"
+			}
+			if errorText, _ := got[12].(string); errorText != "" {
+				got[12] = strings.SplitN(errorText, "\n", 2)[0]
+			}
+			if !reflect.DeepEqual(tt.want[0], got) {
+				t.Errorf("want: %#v, got: %#v", tt.want[0], got)
+			}
+		})
+	}
+}
+
+// ctxExecutor fails statements whose context is done, the way a connection does.
+type ctxExecutor struct {
+	*recordingExecutor
+}
+
+func (e *ctxExecutor) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.recordingExecutor.ExecContext(ctx, query, args...)
+}
+
+func TestRecordHistoryOfCancelledLoad(t *testing.T) {
+	db := &ctxExecutor{&recordingExecutor{}}
+	svc := &DataLoader{
+		DB:           db,
+		Logger:       log.NewNopLogger(),
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc:        newFakeS3("testDB", map[string]string{"testformat1_2015-06-28.txt": "Foonyor   \n"}),
+		HistoryTable: DefaultHistoryTable,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := svc.LoadDataFileToRedshift(ctx, "testformat1_2015-06-28.txt")
+	if err == nil {
+		t.Fatal("want the cancelled load to fail")
+	}
+	n := len(db.statements)
+	if n == 0 || !strings.HasPrefix(db.statements[n-1], "INSERT INTO data_loader.load_history") {
+		t.Fatalf("want the failed load recorded, got: %q", db.statements)
+	}
+	if status := db.args[n-1][11]; status != StatusFailed {
+		t.Errorf("want: %s, got: %v", StatusFailed, status)
+	}
+}
+
+func TestEnsureHistoryTable(t *testing.T) {
+	db := &recordingExecutor{}
+	svc := &DataLoader{DB: db, Logger: log.NewNopLogger(), HistoryTable: DefaultHistoryTable}
+	if err := svc.EnsureHistoryTable(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStatements(t, []string{
+		"CREATE SCHEMA IF NOT EXISTS data_loader;",
+		"CREATE TABLE IF NOT EXISTS data_loader.load_history(load_id VARCHAR(32), file_key VARCHAR(1024),",
+	}, db.statements)
+
+	svc.HistoryTable = "load_history; DROP TABLE x"
+	if err := svc.EnsureHistoryTable(context.Background()); err == nil {
+		t.Error("want an error for an invalid history table")
+	}
+}
+
+func TestLoadHistory(t *testing.T) {
+	startedAt := time.Date(2018, 11, 15, 10, 30, 0, 0, time.UTC)
+	db := &recordingExecutor{rows: map[string][][]interface{}{"SELECT load_id": {
+		{"0123456789abcdef0123456789abcdef", "orders_2018-11-15.txt", "raw.orders", LoadModeStagingTable, int64(3),
+			int64(2), int64(1), int64(45), "6f5902ac237024bdd0c176cb93063dc4", startedAt, int64(1500), StatusFailed,
+			ErrorClassData, "row count mismatch"},
+		{"fedcba9876543210fedcba9876543210", "orders_2018-11-14.txt", "raw.orders", nil, int64(0),
+			int64(0), int64(0), int64(0), nil, "2018-11-14 10:30:00", int64(20), StatusFailed, ErrorClassSchema, "bad"},
+	}}}
+	svc := &DataLoader{DB: db, Logger: log.NewNopLogger(), HistoryTable: DefaultHistoryTable}
+
+	got, err := svc.LoadHistory(context.Background(), HistoryFilter{
+		Table:  "raw.orders",
+		From:   startedAt.AddDate(0, 0, -7),
+		To:     startedAt.AddDate(0, 0, 1),
+		Status: StatusFailed,
+		Limit:  10,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []HistoryEntry{
+		{
+			LoadID: "0123456789abcdef0123456789abcdef", Key: "orders_2018-11-15.txt", Table: "raw.orders",
+			Mode: LoadModeStagingTable, SourceRows: 3, RowsLoaded: 2, RowsRejected: 1, Bytes: 45,
+			SchemaVersion: "6f5902ac237024bdd0c176cb93063dc4", StartedAt: startedAt, Duration: 1500 * time.Millisecond,
+			Status: StatusFailed, ErrorClass: ErrorClassData, Error: "row count mismatch",
+		},
+		{
+			LoadID: "fedcba9876543210fedcba9876543210", Key: "orders_2018-11-14.txt", Table: "raw.orders",
+			StartedAt: startedAt.AddDate(0, 0, -1), Duration: 20 * time.Millisecond, Status: StatusFailed,
+			ErrorClass: ErrorClassSchema, Error: "bad",
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %+v\ngot:  %+v", want, got)
+	}
+
+	wantQuery := "SELECT " + historyColumns + " FROM data_loader.load_history WHERE table_name = $1 AND started_at >= $2 " +
+		"AND started_at < $3 AND status = $4 ORDER BY started_at DESC, table_name LIMIT 10;"
+	if db.statements[0] != wantQuery {
+		t.Errorf("want: %s\ngot:  %s", wantQuery, db.statements[0])
+	}
+	wantArgs := []interface{}{"raw.orders", startedAt.AddDate(0, 0, -7), startedAt.AddDate(0, 0, 1), StatusFailed}
+	if !reflect.DeepEqual(wantArgs, db.args[0]) {
+		t.Errorf("want: %v, got: %v", wantArgs, db.args[0])
+	}
+
+	svc.HistoryTable = "load history"
+	if _, err = svc.LoadHistory(context.Background(), HistoryFilter{}); err == nil {
+		t.Errorf("want: an error for an invalid history table, got: nil")
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "short", n: 10, want: "short"},
+		{s: "abcdef", n: 3, want: "abc"},
+		{s: "aé", n: 2, want: "a"},
+	} {
+		if got := truncateUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d), want: %q, got: %q", tt.s, tt.n, tt.want, got)
+		}
+	}
+}
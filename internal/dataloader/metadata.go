@@ -0,0 +1,84 @@
+package dataloader
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// System columns a schema can opt in to, populated by the loader rather than from the data file.
+const (
+	// Key of the object the row was loaded from.
+	metadataSourceFile = "source_file"
+	// ID shared by every row loaded by the same load.
+	metadataLoadID = "load_id"
+	// When the load ran.
+	metadataLoadedAt = "loaded_at"
+	// Business date of the file, from its control records or else its name.
+	metadataFileDate = "file_date"
+)
+
+// Redshift types of the metadata columns.
+var metadataColumnTypes = map[string]string{
+	metadataSourceFile: "VARCHAR(1024)",
+	metadataLoadID:     "CHAR(32)",
+	metadataLoadedAt:   "TIMESTAMP",
+	metadataFileDate:   "DATE",
+}
+
+// Checks the metadata columns a schema opted in to are known and don't clash with its data columns.
+func validateMetadataColumns(metadata []string, layouts []tableLayout) error {
+	set := make(map[string]struct{})
+	for _, name := range metadata {
+		if _, ok := metadataColumnTypes[name]; !ok {
+			return fmt.Errorf("unknown metadata column %s", name)
+		}
+		if _, ok := set[name]; ok {
+			return fmt.Errorf("duplicate metadata column %s", name)
+		}
+		set[name] = struct{}{}
+	}
+	for _, layout := range layouts {
+		for _, col := range layout.Columns {
+			if _, ok := set[col.Name]; ok {
+				return fmt.Errorf("metadata column %s clashes with a data column", col.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Renders the SQL literal the passed metadata column is populated with for rows loaded from source.
+func metadataValue(name string, source *sourceFile) string {
+	switch name {
+	case metadataSourceFile:
+		return quoteLiteral(source.Key)
+	case metadataLoadID:
+		return quoteLiteral(source.LoadID)
+	case metadataLoadedAt:
+		return quoteLiteral(source.LoadedAt.Format("2006-01-02 15:04:05.000000")) + "::TIMESTAMP"
+	case metadataFileDate:
+		if source.PartitionDate.IsZero() {
+			return "NULL::DATE"
+		}
+		return quoteLiteral(source.PartitionDate.Format("2006-01-02")) + "::DATE"
+	}
+	return "NULL"
+}
+
+// Quotes s as a SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// Generates a random ID identifying a single load.
+func newLoadID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// Fall back to something still unique enough to tell loads apart
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestValidateMetadataColumns(t *testing.T) {
+	layouts := []tableLayout{{Table: "t", Columns: []dBColumnSchema{{Width: "4", Name: "load_id", DataType: "TEXT"}}}}
+	tests := []struct {
+		name     string
+		metadata []string
+		err      error
+	}{
+		{name: "happy-path", metadata: []string{"source_file", "loaded_at", "file_date"}},
+		{name: "unknown", metadata: []string{"row_number"}, err: errors.New("unknown metadata column row_number")},
+		{name: "duplicate", metadata: []string{"file_date", "file_date"}, err: errors.New("duplicate metadata column file_date")},
+		{name: "clash", metadata: []string{"load_id"}, err: errors.New("metadata column load_id clashes with a data column")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMetadataColumns(tt.metadata, layouts)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestBuildMetadataQueries(t *testing.T) {
+	svc := &DataLoader{DataBucket: "testDB", Logger: log.NewNopLogger()}
+	columns := []dBColumnSchema{
+		{Width: "10", Name: "name", DataType: "TEXT"},
+		{Width: "3", Name: "count", DataType: "INTEGER"},
+	}
+	metadata := []string{"source_file", "load_id", "loaded_at", "file_date"}
+
+	got, err := svc.buildCreateTableQuery(tableLayout{Table: "testtable", Columns: columns, Metadata: metadata})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "CREATE TABLE testtable( name VARCHAR(10), count INTEGER, source_file VARCHAR(1024), load_id CHAR(32), " +
+		"loaded_at TIMESTAMP, file_date DATE);"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	got, err = svc.buildCreateStagingTableQuery("testtable_staging", columns, encodingUTF8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "CREATE TEMP TABLE testtable_staging( name VARCHAR(10), count INTEGER);"; want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	source := &sourceFile{
+		Key:           "vendor's/testformat1_2015-06-28.txt",
+		LoadID:        "0123456789abcdef0123456789abcdef",
+		LoadedAt:      time.Date(2018, 11, 15, 10, 30, 0, 0, time.UTC),
+		PartitionDate: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+	}
+	got = svc.buildInsertFromStagingQuery(source, copyTarget{Table: "testtable", Columns: columns, Metadata: metadata})
+	want = "INSERT INTO testtable (name, count, source_file, load_id, loaded_at, file_date) " +
+		"SELECT name, count, 'vendor''s/testformat1_2015-06-28.txt', '0123456789abcdef0123456789abcdef', " +
+		"'2018-11-15 10:30:00.000000'::TIMESTAMP, '2015-06-28'::DATE FROM testtable_staging;"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	source.PartitionDate = time.Time{}
+	got = svc.buildInsertFromStagingQuery(source, copyTarget{Table: "testtable", Columns: columns, Metadata: []string{"file_date"}})
+	if want := "INSERT INTO testtable (name, count, file_date) SELECT name, count, NULL::DATE FROM testtable_staging;"; want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestExecuteCopyWithMetadata(t *testing.T) {
+	db := &recordingExecutor{rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{int64(3)}}}}
+	svc := &DataLoader{DataBucket: "testDB", Logger: log.NewNopLogger(), DB: db}
+	columns := []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}}
+	source := &sourceFile{
+		Key:      "testformat1_2015-06-28.txt",
+		LoadID:   "0123456789abcdef0123456789abcdef",
+		LoadedAt: time.Date(2018, 11, 15, 10, 30, 0, 0, time.UTC),
+		Targets: []copyTarget{{
+			Table:       "testformat1",
+			Columns:     columns,
+			CopyColumns: columns,
+			Metadata:    []string{"load_id"},
+			CopyKey:     "testformat1_2015-06-28.txt",
+			Rows:        3,
+		}},
+	}
+
+	if err := svc.runInTransaction(context.Background(), svc.copyStep(source, &LoadResult{})); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	want := []string{
+		"BEGIN",
+		"CREATE TEMP TABLE testformat1_staging( name VARCHAR(10));",
+		"COPY testformat1_staging FROM 's3://testDB/testformat1_2015-06-28.txt'",
+		"SELECT pg_last_copy_count();",
+		"INSERT INTO testformat1 (name, load_id) SELECT name, '0123456789abcdef0123456789abcdef' FROM testformat1_staging;",
+		"DROP TABLE testformat1_staging;",
+		"COMMIT",
+	}
+	assertStatements(t, want, db.statements)
+}
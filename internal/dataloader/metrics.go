@@ -0,0 +1,168 @@
+package dataloader
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// MetricsNamespace is the CloudWatch namespace load metrics are published under.
+const MetricsNamespace = "DataLoader"
+
+// Error classes failed loads are counted by, see ErrorClass.
+const (
+	ErrorClassSchema    = "schema"
+	ErrorClassData      = "data"
+	ErrorClassTransient = "transient"
+	ErrorClassConfig    = "config"
+	ErrorClassUnknown   = "unknown"
+)
+
+// ErrorClass names the class of a load error: schema, data, transient, config or unknown for errors that couldn't be
+// classified. Returns an empty string for nil.
+func ErrorClass(err error) string {
+	var (
+		schemaErr *SchemaError
+		dataErr   *DataError
+		configErr *ConfigError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case IsTransient(err):
+		return ErrorClassTransient
+	case errors.As(err, &schemaErr):
+		return ErrorClassSchema
+	case errors.As(err, &dataErr):
+		return ErrorClassData
+	case errors.As(err, &configErr):
+		return ErrorClassConfig
+	}
+	return ErrorClassUnknown
+}
+
+// emfDocument is a CloudWatch embedded metric format document: the metric values and dimensions are top level members,
+// _aws declares which of them CloudWatch extracts as metrics.
+// https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+type emfDocument map[string]interface{}
+
+type emfMetadata struct {
+	Timestamp         int64                `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricDirective `json:"CloudWatchMetrics"`
+}
+
+type emfMetricDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// Builds a document of the passed values declaring each of metrics as dimensioned by dimensions.
+func newEMFDocument(timestamp time.Time, dimensions map[string]string, metrics []emfMetric, values map[string]interface{}) emfDocument {
+	doc := emfDocument{}
+	var names []string
+	for _, name := range []string{"Environment", "Table", "ErrorClass"} {
+		if value, ok := dimensions[name]; ok {
+			doc[name] = value
+			names = append(names, name)
+		}
+	}
+	for name, value := range values {
+		doc[name] = value
+	}
+	doc["_aws"] = emfMetadata{
+		Timestamp: timestamp.UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfMetricDirective{{
+			Namespace:  MetricsNamespace,
+			Dimensions: [][]string{names},
+			Metrics:    metrics,
+		}},
+	}
+	return doc
+}
+
+// Builds the metric documents of a load, one for the load as a whole dimensioned by its target, one per table it
+// loaded into dimensioned by the qualified table name, and one counting the failure by class if err is set.
+func loadMetrics(env string, timestamp time.Time, result *LoadResult, err error) []emfDocument {
+	milliseconds := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	docs := []emfDocument{newEMFDocument(timestamp,
+		map[string]string{"Environment": env, "Table": result.Target},
+		[]emfMetric{
+			{Name: "Loads", Unit: "Count"},
+			{Name: "Bytes", Unit: "Bytes"},
+			{Name: "FetchSchemaDuration", Unit: "Milliseconds"},
+			{Name: "PrepareDuration", Unit: "Milliseconds"},
+			{Name: "CreateTablesDuration", Unit: "Milliseconds"},
+			{Name: "CopyDuration", Unit: "Milliseconds"},
+			{Name: "TotalDuration", Unit: "Milliseconds"},
+		},
+		map[string]interface{}{
+			"Loads":                1,
+			"Bytes":                result.Bytes,
+			"FetchSchemaDuration":  milliseconds(result.Durations.FetchSchema),
+			"PrepareDuration":      milliseconds(result.Durations.Prepare),
+			"CreateTablesDuration": milliseconds(result.Durations.CreateTables),
+			"CopyDuration":         milliseconds(result.Durations.Copy),
+			"TotalDuration":        milliseconds(result.Durations.Total),
+			"Key":                  result.Key,
+			"LoadID":               result.LoadID,
+		},
+	)}
+	for _, table := range result.Tables {
+		created := 0
+		if table.Created {
+			created = 1
+		}
+		docs = append(docs, newEMFDocument(timestamp,
+			map[string]string{"Environment": env, "Table": table.Table},
+			[]emfMetric{
+				{Name: "RowsLoaded", Unit: "Count"},
+				{Name: "RowsRejected", Unit: "Count"},
+				{Name: "TablesCreated", Unit: "Count"},
+			},
+			map[string]interface{}{
+				"RowsLoaded":    table.RowsLoaded,
+				"RowsRejected":  table.RowsRejected,
+				"TablesCreated": created,
+				"LoadID":        result.LoadID,
+			},
+		))
+	}
+	if err != nil {
+		docs = append(docs, newEMFDocument(timestamp,
+			map[string]string{"Environment": env, "Table": result.Target, "ErrorClass": ErrorClass(err)},
+			[]emfMetric{{Name: "LoadFailures", Unit: "Count"}},
+			map[string]interface{}{
+				"LoadFailures": 1,
+				"Key":          result.Key,
+				"LoadID":       result.LoadID,
+			},
+		))
+	}
+	return docs
+}
+
+// Writes the metric documents of a load to d.Metrics, one per line. Failures are only logged since the load itself
+// is already decided.
+func (d *DataLoader) writeMetrics(result *LoadResult, err error) {
+	if d.Metrics == nil {
+		return
+	}
+	for _, doc := range loadMetrics(d.Env, d.currentTime(), result, err) {
+		line, err := json.Marshal(doc)
+		if err == nil {
+			_, err = d.Metrics.Write(append(line, '\n'))
+		}
+		if err != nil {
+			level.Warn(d.Logger).Log("msg", "failed to write load metrics", "err", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package dataloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestLoadMetrics(t *testing.T) {
+	result := &LoadResult{
+		Key:    "testformat1_2015-06-28.txt",
+		Target: "testformat1",
+		LoadID: "0123456789abcdef0123456789abcdef",
+		Bytes:  45,
+		Tables: []TableResult{{Table: "raw.testformat1", Created: true, SourceRows: 3, RowsLoaded: 2, RowsRejected: 1}},
+		Durations: PhaseDurations{
+			FetchSchema:  2 * time.Millisecond,
+			Prepare:      3 * time.Millisecond,
+			CreateTables: 1500 * time.Microsecond,
+			Copy:         10 * time.Millisecond,
+			Total:        17 * time.Millisecond,
+		},
+	}
+	timestamp := time.Date(2018, 11, 15, 10, 30, 0, 0, time.UTC)
+	err := &DataError{errors.New("row count mismatch")}
+
+	want := []string{
+		`{"Bytes":45,"CopyDuration":10,"CreateTablesDuration":1.5,"Environment":"test","FetchSchemaDuration":2,` +
+			`"Key":"testformat1_2015-06-28.txt","LoadID":"0123456789abcdef0123456789abcdef","Loads":1,"PrepareDuration":3,` +
+			`"Table":"testformat1","TotalDuration":17,"_aws":{"Timestamp":1542277800000,"CloudWatchMetrics":[{` +
+			`"Namespace":"DataLoader","Dimensions":[["Environment","Table"]],"Metrics":[{"Name":"Loads","Unit":"Count"},` +
+			`{"Name":"Bytes","Unit":"Bytes"},{"Name":"FetchSchemaDuration","Unit":"Milliseconds"},` +
+			`{"Name":"PrepareDuration","Unit":"Milliseconds"},{"Name":"CreateTablesDuration","Unit":"Milliseconds"},` +
+			`{"Name":"CopyDuration","Unit":"Milliseconds"},{"Name":"TotalDuration","Unit":"Milliseconds"}]}]}}`,
+		`{"Environment":"test","LoadID":"0123456789abcdef0123456789abcdef","RowsLoaded":2,"RowsRejected":1,` +
+			`"Table":"raw.testformat1","TablesCreated":1,"_aws":{"Timestamp":1542277800000,"CloudWatchMetrics":[{` +
+			`"Namespace":"DataLoader","Dimensions":[["Environment","Table"]],"Metrics":[{"Name":"RowsLoaded","Unit":"Count"},` +
+			`{"Name":"RowsRejected","Unit":"Count"},{"Name":"TablesCreated","Unit":"Count"}]}]}}`,
+		`{"Environment":"test","ErrorClass":"data","Key":"testformat1_2015-06-28.txt",` +
+			`"LoadFailures":1,"LoadID":"0123456789abcdef0123456789abcdef","Table":"testformat1","_aws":{"Timestamp":1542277800000,` +
+			`"CloudWatchMetrics":[{"Namespace":"DataLoader","Dimensions":[["Environment","Table","ErrorClass"]],` +
+			`"Metrics":[{"Name":"LoadFailures","Unit":"Count"}]}]}}`,
+	}
+	docs := loadMetrics("test", timestamp, result, err)
+	if len(docs) != len(want) {
+		t.Fatalf("want: %d documents, got: %d", len(want), len(docs))
+	}
+	for i, doc := range docs {
+		got, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(got) != want[i] {
+			t.Errorf("document %d\nwant: %s\ngot:  %s", i, want[i], got)
+		}
+	}
+}
+
+func TestLoadWritesMetrics(t *testing.T) {
+	var metrics bytes.Buffer
+	svc := &DataLoader{
+		DB:           &recordingExecutor{},
+		Logger:       log.NewNopLogger(),
+		Env:          "test",
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc:        newFakeS3("testDB", map[string]string{"testformat1_2015-06-28.txt": "Foonyor   1  1\n"}),
+		Metrics:      &metrics,
+	}
+	if _, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt"); err == nil {
+		t.Fatalf("want: an error for a missing definition, got: nil")
+	}
+	lines := strings.Split(strings.TrimSuffix(metrics.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want: a load and a failure document, got: %q", lines)
+	}
+	var failure map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &failure); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if failure["ErrorClass"] != ErrorClassSchema || failure["Table"] != "testformat1" || failure["Environment"] != "test" {
+		t.Errorf("unexpected failure document: %s", lines[1])
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: ""},
+		{err: errors.New("boom"), want: ErrorClassUnknown},
+		{err: &SchemaError{errors.New("bad")}, want: ErrorClassSchema},
+		{err: &DataError{errors.New("bad")}, want: ErrorClassData},
+		{err: &ConfigError{errors.New("bad")}, want: ErrorClassConfig},
+		{err: &TransientError{&DataError{errors.New("read failed")}}, want: ErrorClassTransient},
+	}
+	for _, tt := range tests {
+		if got := ErrorClass(tt.err); got != tt.want {
+			t.Errorf("%v, want: %q, got: %q", tt.err, tt.want, got)
+		}
+	}
+}
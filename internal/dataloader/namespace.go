@@ -0,0 +1,43 @@
+package dataloader
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// Unquoted redshift identifiers, which is all schema names are ever rendered as.
+// https://docs.aws.amazon.com/redshift/latest/dg/r_names.html
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]{0,126}$`)
+
+// Checks a target schema name from a table definition can be used unquoted in SQL.
+func validateTargetSchema(name string) error {
+	if name != "" && !identifierPattern.MatchString(name) {
+		return fmt.Errorf("invalid target_schema %q", name)
+	}
+	return nil
+}
+
+// Qualifies tableName with schemaName, leaving it to the search path when there is no schema.
+func qualifiedTableName(schemaName, tableName string) string {
+	if schemaName == "" {
+		return tableName
+	}
+	return schemaName + "." + tableName
+}
+
+// Creates the passed redshift schema unless it already exists.
+func (d *DataLoader) createSchemaIfMissing(ctx context.Context, q Queryer, schemaName string) error {
+	if schemaName == "" {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", schemaName))
+	if err != nil {
+		// IF NOT EXISTS doesn't guard against a schema created concurrently
+		return classifyCreateError(err)
+	}
+	level.Debug(d.Logger).Log("msg", "ensured schema exists", "schema_name", schemaName)
+	return nil
+}
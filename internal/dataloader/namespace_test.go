@@ -0,0 +1,85 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-kit/kit/log"
+)
+
+func TestValidateTargetSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    error
+	}{
+		{name: "none"},
+		{name: "happy-path", schema: "raw_vendor_x"},
+		{name: "leading-digit", schema: "1raw", err: errors.New(`invalid target_schema "1raw"`)},
+		{name: "injection", schema: "raw; DROP TABLE x", err: errors.New(`invalid target_schema "raw; DROP TABLE x"`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTargetSchema(tt.schema)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestBuildQueriesWithTargetSchema(t *testing.T) {
+	svc := &DataLoader{DataBucket: "testDB", Logger: log.NewNopLogger()}
+	columns := []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}}
+
+	got, err := svc.buildCreateTableQuery(tableLayout{Schema: "raw_vendor_x", Table: "testtable", Columns: columns})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "CREATE TABLE raw_vendor_x.testtable( name VARCHAR(10));"; want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	target := copyTarget{Schema: "raw_vendor_x", Table: "testtable", Columns: columns}
+	if want, got := "raw_vendor_x.testtable", target.copyTable(); want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	target.Metadata = []string{"source_file"}
+	if want, got := "testtable_staging", target.copyTable(); want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+	got = svc.buildInsertFromStagingQuery(&sourceFile{Key: "testtable_2015-06-28.txt"}, target)
+	want := "INSERT INTO raw_vendor_x.testtable (name, source_file) SELECT name, 'testtable_2015-06-28.txt' FROM testtable_staging;"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestCreateSchemaIfMissing(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	svc := &DataLoader{DB: NewSQLExecutor(db), Logger: log.NewNopLogger()}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("CREATE SCHEMA IF NOT EXISTS raw_vendor_x;")).WillReturnResult(sqlmock.NewResult(0, 0))
+	tx, err := svc.DB.BeginTx(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := svc.createSchemaIfMissing(context.Background(), tx, "raw_vendor_x"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := svc.createSchemaIfMissing(context.Background(), tx, ""); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %s", err)
+	}
+}
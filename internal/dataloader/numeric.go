@@ -0,0 +1,200 @@
+package dataloader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Sign conventions for DECIMAL columns, as found in COBOL-originated files.
+const (
+	// Digits only, always positive.
+	signNone = ""
+	// A separate '+' or '-' before the digits.
+	signLeading = "leading"
+	// A separate '+' or '-' after the digits.
+	signTrailing = "trailing"
+	// Zoned decimal: the last digit's character also carries the sign.
+	signOverpunch = "overpunch"
+)
+
+// Redshift's limit on DECIMAL precision.
+// https://docs.aws.amazon.com/redshift/latest/dg/r_Numeric_types201.html
+const maxDecimalPrecision = 38
+
+// Overpunched final characters and the digit and sign they stand for.
+var overpunchDigits = map[byte]struct {
+	digit    byte
+	negative bool
+}{
+	'{': {'0', false}, 'A': {'1', false}, 'B': {'2', false}, 'C': {'3', false}, 'D': {'4', false},
+	'E': {'5', false}, 'F': {'6', false}, 'G': {'7', false}, 'H': {'8', false}, 'I': {'9', false},
+	'}': {'0', true}, 'J': {'1', true}, 'K': {'2', true}, 'L': {'3', true}, 'M': {'4', true},
+	'N': {'5', true}, 'O': {'6', true}, 'P': {'7', true}, 'Q': {'8', true}, 'R': {'9', true},
+}
+
+// decimalPrecision returns the number of digits a DECIMAL column of the passed width and sign convention holds.
+func decimalPrecision(width int, sign string) int {
+	if sign == signLeading || sign == signTrailing {
+		return width - 1
+	}
+	return width
+}
+
+// needsConversion reports if values of col have to be rewritten before redshift can load them.
+func (col dBColumnSchema) needsConversion() bool {
+	return col.DataType == "DECIMAL" && (col.Scale > 0 || col.Sign != signNone)
+}
+
+// convertedWidth is the width of col's values once rewritten as an explicitly signed decimal.
+func (col dBColumnSchema) convertedWidth() (int, error) {
+	width, err := strconv.Atoi(col.Width)
+	if err != nil {
+		return 0, err
+	}
+	converted := 1 + decimalPrecision(width, col.Sign)
+	if col.Scale > 0 {
+		converted++
+	}
+	return converted, nil
+}
+
+// Converts a raw fixed-width numeric field into an explicitly signed decimal of the passed converted width, zero
+// padded so every converted value is the same width. Blank fields stay blank so they load as NULL.
+func convertDecimal(raw string, scale int, sign string, width int) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return strings.Repeat(" ", width), nil
+	}
+	digits, negative := strings.TrimSpace(raw), false
+	switch sign {
+	case signLeading:
+		if digits[0] == '-' || digits[0] == '+' {
+			negative = digits[0] == '-'
+			digits = strings.TrimSpace(digits[1:])
+		}
+	case signTrailing:
+		if last := digits[len(digits)-1]; last == '-' || last == '+' {
+			negative = last == '-'
+			digits = strings.TrimSpace(digits[:len(digits)-1])
+		}
+	case signOverpunch:
+		if op, ok := overpunchDigits[digits[len(digits)-1]]; ok {
+			negative = op.negative
+			digits = digits[:len(digits)-1] + string(op.digit)
+		}
+	}
+	if digits == "" {
+		return "", fmt.Errorf("invalid numeric value %q", raw)
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return "", fmt.Errorf("invalid numeric value %q", raw)
+		}
+	}
+
+	precision := width - 1
+	if scale > 0 {
+		precision--
+	}
+	if len(digits) > precision {
+		return "", fmt.Errorf("numeric value %q has more than %d digits", raw, precision)
+	}
+	digits = strings.Repeat("0", precision-len(digits)) + digits
+
+	var sb strings.Builder
+	if negative {
+		sb.WriteByte('-')
+	} else {
+		sb.WriteByte('+')
+	}
+	sb.WriteString(digits[:precision-scale])
+	if scale > 0 {
+		sb.WriteByte('.')
+		sb.WriteString(digits[precision-scale:])
+	}
+	return sb.String(), nil
+}
+
+// rowConverter rewrites the DECIMAL columns of fixed-width rows that need conversion, leaving the other columns as
+// they are.
+type rowConverter struct {
+	columns []convertedColumn
+}
+
+type convertedColumn struct {
+	start, end int
+	scale      int
+	sign       string
+	width      int
+}
+
+// newRowConverter returns a converter for rows of passed layout, or nil if none of its columns need converting.
+func newRowConverter(columns []dBColumnSchema) (*rowConverter, error) {
+	c := &rowConverter{}
+	pos := 0
+	for _, col := range columns {
+		width, err := strconv.Atoi(col.Width)
+		if err != nil {
+			return nil, err
+		}
+		if col.needsConversion() {
+			if precision := decimalPrecision(width, col.Sign); col.Scale < 0 || col.Scale > precision {
+				return nil, fmt.Errorf("column %s scale %d is invalid for DECIMAL precision %d", col.Name, col.Scale, precision)
+			}
+			converted, err := col.convertedWidth()
+			if err != nil {
+				return nil, err
+			}
+			c.columns = append(c.columns, convertedColumn{
+				start: pos,
+				end:   pos + width,
+				scale: col.Scale,
+				sign:  col.Sign,
+				width: converted,
+			})
+		}
+		pos += width
+	}
+	if len(c.columns) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+func (c *rowConverter) convert(row string) (string, error) {
+	trimmed := strings.TrimRight(row, "\r\n")
+	body := []rune(trimmed)
+	var sb strings.Builder
+	pos := 0
+	for _, col := range c.columns {
+		if col.end > len(body) {
+			return "", fmt.Errorf("row too short for column ending at %d", col.end)
+		}
+		sb.WriteString(string(body[pos:col.start]))
+		converted, err := convertDecimal(string(body[col.start:col.end]), col.scale, col.sign, col.width)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(converted)
+		pos = col.end
+	}
+	sb.WriteString(string(body[pos:]))
+	sb.WriteString(row[len(trimmed):])
+	return sb.String(), nil
+}
+
+// stagedColumns returns the layout of rows once converted, which is what COPY has to be told about.
+func stagedColumns(columns []dBColumnSchema) ([]dBColumnSchema, error) {
+	staged := make([]dBColumnSchema, 0, len(columns))
+	for _, col := range columns {
+		if col.needsConversion() {
+			converted, err := col.convertedWidth()
+			if err != nil {
+				return nil, err
+			}
+			col = dBColumnSchema{Name: col.Name, Width: strconv.Itoa(converted), DataType: col.DataType}
+		}
+		staged = append(staged, col)
+	}
+	return staged, nil
+}
@@ -0,0 +1,87 @@
+package dataloader
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConvertDecimal(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		scale int
+		sign  string
+		width int
+		err   error
+		want  string
+	}{
+		{name: "implied-decimal", raw: "12345", scale: 2, width: 7, want: "+123.45"},
+		{name: "implied-decimal-padded", raw: "  345", scale: 2, width: 7, want: "+003.45"},
+		{name: "no-scale", raw: " +042", sign: signLeading, width: 5, want: "+0042"},
+		{name: "leading-minus", raw: "-1234", scale: 2, sign: signLeading, width: 6, want: "-12.34"},
+		{name: "leading-plus", raw: "+1234", scale: 2, sign: signLeading, width: 6, want: "+12.34"},
+		{name: "trailing-minus", raw: "1234-", scale: 1, sign: signTrailing, width: 6, want: "-123.4"},
+		{name: "overpunch-positive", raw: "1234E", scale: 2, sign: signOverpunch, width: 7, want: "+123.45"},
+		{name: "overpunch-negative", raw: "1234N", scale: 2, sign: signOverpunch, width: 7, want: "-123.45"},
+		{name: "overpunch-negative-zero", raw: "0010}", scale: 2, sign: signOverpunch, width: 7, want: "-001.00"},
+		{name: "overpunch-plain-digit", raw: "12345", scale: 2, sign: signOverpunch, width: 7, want: "+123.45"},
+		{name: "blank", raw: "     ", scale: 2, width: 7, want: "       "},
+		{name: "not-numeric", raw: "12a45", scale: 2, width: 7, err: errors.New("invalid numeric value \"12a45\"")},
+		{name: "sign-only", raw: "    -", sign: signTrailing, width: 5, err: errors.New("invalid numeric value \"    -\"")},
+		{name: "unexpected-sign", raw: "-1234", scale: 2, width: 7, err: errors.New("invalid numeric value \"-1234\"")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertDecimal(tt.raw, tt.scale, tt.sign, tt.width)
+			if tt.err != nil {
+				if err == nil || tt.err.Error() != err.Error() {
+					t.Errorf("want: %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.want != got {
+				t.Errorf("want: %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRowConverter(t *testing.T) {
+	columns := []dBColumnSchema{
+		{Width: "10", Name: "name", DataType: "TEXT"},
+		{Width: "5", Name: "amount", DataType: "DECIMAL", Scale: 2, Sign: signOverpunch},
+		{Width: "3", Name: "count", DataType: "INTEGER"},
+		{Width: "4", Name: "rate", DataType: "DECIMAL", Scale: 1, Sign: signTrailing},
+	}
+	converter, err := newRowConverter(columns)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := converter.convert("Foonyor   1234N  1123-\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "Foonyor   -123.45  1-12.3\n"; want != got {
+		t.Errorf("want: %q, got: %q", want, got)
+	}
+
+	staged, err := stagedColumns(columns)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if staged[1].Width != "7" || staged[3].Width != "5" || staged[0].Width != "10" {
+		t.Errorf("unexpected staged layout: %+v", staged)
+	}
+
+	if _, err := converter.convert("Foonyor   12"); err == nil {
+		t.Errorf("expected error converting short row")
+	}
+
+	converter, err = newRowConverter([]dBColumnSchema{{Width: "5", Name: "count", DataType: "INTEGER"}})
+	if err != nil || converter != nil {
+		t.Errorf("want: nil converter, got: %v %v", converter, err)
+	}
+}
@@ -0,0 +1,115 @@
+package dataloader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Databases a DataLoader can load into.
+const (
+	// TargetRedshift, the default, has redshift COPY the staged files from S3 itself.
+	TargetRedshift = "redshift"
+	// TargetPostgres streams the staged files from S3 through the loader into a PostgreSQL COPY FROM STDIN, so loads
+	// can be run end to end against a local database.
+	TargetPostgres = "postgres"
+)
+
+// copyInTx is a transaction that can COPY rows the loader reads itself, like PostgreSQL's COPY FROM STDIN. next
+// returns the values of one row per call and io.EOF after the last. Returns the number of rows copied.
+type copyInTx interface {
+	copyIn(ctx context.Context, schemaName, tableName string, columns []string, next func() ([]interface{}, error)) (int64, error)
+}
+
+// Copies the target's staged file into its table through COPY FROM STDIN, splitting each fixed width line into the
+// values of its copy columns on the way.
+func (d *DataLoader) copyFromStdin(ctx context.Context, tx Tx, target copyTarget) (int64, error) {
+	copier, ok := tx.(copyInTx)
+	if !ok {
+		return 0, &ConfigError{fmt.Errorf("target %s needs a database/sql executor supporting COPY FROM STDIN", TargetPostgres)}
+	}
+
+	columns := make([]string, len(target.CopyColumns))
+	widths := make([]int, len(target.CopyColumns))
+	blankNull := make([]bool, len(target.CopyColumns))
+	for i, col := range target.CopyColumns {
+		width, err := strconv.Atoi(col.Width)
+		if err != nil {
+			return 0, &SchemaError{err}
+		}
+		columns[i], widths[i] = strings.ToLower(col.Name), width
+		// Redshift always loads blank fields of other than character columns as NULL, PostgreSQL rejects them
+		blankNull[i] = col.DataType != "TEXT"
+	}
+
+	dataRsp, err := d.S3Svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.DataBucket),
+		Key:    aws.String(target.CopyKey),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer dataRsp.Body.Close()
+
+	schemaName, tableName := target.Schema, target.Table
+	if target.viaStagingTable() {
+		schemaName, tableName = "", target.copyTable()
+	}
+	return copier.copyIn(ctx, strings.ToLower(schemaName), strings.ToLower(tableName), columns,
+		fixedWidthRows(dataRsp.Body, widths, blankNull))
+}
+
+// Returns a copy of layout without the compression encodings and table options PostgreSQL doesn't have. They are
+// validated when the schema is loaded, so tables are created the same way on either database otherwise.
+func withoutRedshiftAttributes(layout tableLayout) tableLayout {
+	columns := make([]dBColumnSchema, len(layout.Columns))
+	for i, col := range layout.Columns {
+		col.Encode = ""
+		columns[i] = col
+	}
+	layout.Columns = columns
+	layout.Options = tableOptions{}
+	return layout
+}
+
+// Returns a row reader splitting the newline terminated records of r into fields of passed widths, counted in
+// characters the way redshift's FIXEDWIDTH does. Fields that are blank are read as NULL where blankNull is set.
+func fixedWidthRows(r io.Reader, widths []int, blankNull []bool) func() ([]interface{}, error) {
+	lineLength := 0
+	for _, width := range widths {
+		lineLength += width
+	}
+	reader := bufio.NewReader(r)
+	lineNumber := 0
+	return func() ([]interface{}, error) {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		lineNumber++
+		record := []rune(strings.TrimRight(line, "\r\n"))
+		if len(record) < lineLength {
+			return nil, &DataError{fmt.Errorf("line %d has %d characters, expected %d", lineNumber, len(record), lineLength)}
+		}
+		values := make([]interface{}, len(widths))
+		offset := 0
+		for i, width := range widths {
+			field := string(record[offset : offset+width])
+			offset += width
+			if blankNull[i] && strings.TrimSpace(field) == "" {
+				continue
+			}
+			values[i] = field
+		}
+		return values, nil
+	}
+}
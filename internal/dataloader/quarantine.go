@@ -0,0 +1,51 @@
+package dataloader
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-kit/kit/log/level"
+)
+
+// QuarantinePrefix is the prefix of the data bucket data files that can't ever load are moved to, each next to a
+// <key>.error object saying why. Objects under it are never loaded.
+const QuarantinePrefix = "quarantine/"
+
+// IsQuarantineKey reports if the passed data bucket key is under the quarantine prefix.
+func IsQuarantineKey(key string) bool {
+	return strings.HasPrefix(key, QuarantinePrefix)
+}
+
+// QuarantineDataFile moves the data file at key into the quarantine prefix of the data bucket, next to a <key>.error
+// object holding cause. Meant for files failing permanently, see IsPermanent, which retrying would only fail again.
+func (d *DataLoader) QuarantineDataFile(ctx context.Context, key string, cause error) error {
+	quarantineKey := QuarantinePrefix + key
+	_, err := d.S3Svc.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(d.DataBucket),
+		Key:        aws.String(quarantineKey),
+		CopySource: aws.String((&url.URL{Path: d.DataBucket + "/" + key}).EscapedPath()),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = d.S3Svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.DataBucket),
+		Key:    aws.String(quarantineKey + ".error"),
+		Body:   strings.NewReader(cause.Error() + "\n"),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = d.S3Svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(d.DataBucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return err
+	}
+	level.Warn(d.Logger).Log("msg", "quarantined data file", "file_name", key, "quarantine_key", quarantineKey, "err", cause)
+	return nil
+}
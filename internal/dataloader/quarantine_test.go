@@ -0,0 +1,32 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestQuarantineDataFile(t *testing.T) {
+	s3Svc := newFakeS3("testDB", map[string]string{"vendor x/testformat1_2015-06-28.txt": "Foonyor   1  1\n"})
+	svc := &DataLoader{DataBucket: "testDB", Logger: log.NewNopLogger(), S3Svc: s3Svc}
+
+	cause := &DataError{errors.New("row 1 has unknown record type \"Fo\"")}
+	if err := svc.QuarantineDataFile(context.Background(), "vendor x/testformat1_2015-06-28.txt", cause); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := s3Svc.Object("testDB", "vendor x/testformat1_2015-06-28.txt"); ok {
+		t.Errorf("data file was not removed")
+	}
+	if got, _ := s3Svc.Object("testDB", "quarantine/vendor x/testformat1_2015-06-28.txt"); got != "Foonyor   1  1\n" {
+		t.Errorf("want: the data file, got: %q", got)
+	}
+	if got, _ := s3Svc.Object("testDB", "quarantine/vendor x/testformat1_2015-06-28.txt.error"); got != cause.Error()+"\n" {
+		t.Errorf("want: %q, got: %q", cause.Error()+"\n", got)
+	}
+
+	if err := svc.QuarantineDataFile(context.Background(), "missing.txt", cause); err == nil {
+		t.Errorf("want: an error for a missing file, got: nil")
+	}
+}
@@ -0,0 +1,83 @@
+package dataloader
+
+import "time"
+
+// LoadResult describes what a load of a data file did. Loads that fail return it filled in as far as they got.
+type LoadResult struct {
+	// Key of the data file as it was dropped into the data bucket.
+	Key string `json:"key"`
+	// Table name the file's key starts with, naming its table definition.
+	Target string `json:"target"`
+	// Identifies this load of the file, the value of the load_id metadata column.
+	LoadID string `json:"load_id"`
+	// When the load started.
+	StartedAt time.Time `json:"started_at"`
+	// ETag of the table definition the file was loaded with.
+	SchemaVersion string `json:"schema_version,omitempty"`
+	// Size of the data file in bytes.
+	Bytes int64 `json:"bytes"`
+	// One result per table the file loads into, in the order they are loaded.
+	Tables []TableResult `json:"tables"`
+	// Time spent in each phase of the load.
+	Durations PhaseDurations `json:"durations"`
+}
+
+// TableResult is what a load did to one table. Created and RowsLoaded describe the load's transaction, so they were
+// rolled back when the load failed.
+type TableResult struct {
+	// Table name, qualified with its schema if it has one.
+	Table string `json:"table"`
+	// Created reports if the table didn't exist and was created by the load.
+	Created bool `json:"created"`
+	// How rows were loaded into the table, LoadModeDirect or LoadModeStagingTable. Empty if the load failed before.
+	Mode string `json:"mode,omitempty"`
+	// Data rows found in the file for the table, not counting control records.
+	SourceRows int64 `json:"source_rows"`
+	// Rows the database reports COPY loaded.
+	RowsLoaded int64 `json:"rows_loaded"`
+	// Rows found in the file COPY didn't load, which fails the load.
+	RowsRejected int64 `json:"rows_rejected"`
+}
+
+// How rows are loaded into a table.
+const (
+	// LoadModeDirect COPYs into the table itself.
+	LoadModeDirect = "direct"
+	// LoadModeStagingTable COPYs into a temporary staging table and inserts from there, adding metadata columns and
+	// applying transforms.
+	LoadModeStagingTable = "staging_table"
+)
+
+// PhaseDurations is the time a load spent in each of its phases, in nanoseconds when encoded as JSON.
+type PhaseDurations struct {
+	// Fetching and validating the table definition.
+	FetchSchema time.Duration `json:"fetch_schema"`
+	// Counting the file's rows and staging a rewritten copy of it, if needed.
+	Prepare time.Duration `json:"prepare"`
+	// Creating the target schema and missing tables.
+	CreateTables time.Duration `json:"create_tables"`
+	// COPYing into the tables, including inserts from staging tables.
+	Copy time.Duration `json:"copy"`
+	// The whole load.
+	Total time.Duration `json:"total"`
+}
+
+// Returns the result of the named table, adding one if there is none yet.
+func (r *LoadResult) table(name string) *TableResult {
+	for i := range r.Tables {
+		if r.Tables[i].Table == name {
+			return &r.Tables[i]
+		}
+	}
+	r.Tables = append(r.Tables, TableResult{Table: name})
+	return &r.Tables[len(r.Tables)-1]
+}
+
+// RowsLoaded is the number of rows loaded into all tables.
+func (r *LoadResult) RowsLoaded() int64 {
+	var rows int64
+	for _, t := range r.Tables {
+		rows += t.RowsLoaded
+	}
+	return rows
+}
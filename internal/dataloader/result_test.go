@@ -0,0 +1,77 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestLoadResult(t *testing.T) {
+	tests := []struct {
+		name   string
+		copied int64
+		exists bool
+		err    error
+		want   []TableResult
+	}{
+		{
+			name:   "created",
+			copied: 3,
+			want:   []TableResult{{Table: "raw.testformat1", Created: true, Mode: LoadModeDirect, SourceRows: 3, RowsLoaded: 3}},
+		},
+		{
+			name:   "existing",
+			copied: 3,
+			exists: true,
+			want:   []TableResult{{Table: "raw.testformat1", Mode: LoadModeDirect, SourceRows: 3, RowsLoaded: 3}},
+		},
+		{
+			name:   "rows-rejected",
+			copied: 2,
+			err:    errors.New("row count mismatch for testformat1_2015-06-28.txt: source file has 3 rows, copy loaded 2"),
+			want:   []TableResult{{Table: "raw.testformat1", Created: true, Mode: LoadModeDirect, SourceRows: 3, RowsLoaded: 2, RowsRejected: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &recordingExecutor{rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{tt.copied}}}}
+			if tt.exists {
+				db.rows["SELECT TABLE_SCHEMA"] = [][]interface{}{
+					{"raw", "name", "character varying", int64(10), nil, nil, "YES"},
+					{"raw", "count", "character varying", int64(4), nil, nil, "YES"},
+				}
+			}
+			svc := &DataLoader{
+				DB:           db,
+				Logger:       log.NewNopLogger(),
+				DataBucket:   "testDB",
+				SchemaBucket: "testSchemas",
+				loadID:       func() string { return "0123456789abcdef0123456789abcdef" },
+			}
+			s3Svc := newFakeS3("testDB", map[string]string{"testformat1_2015-06-28.txt": "Foonyor   1  1\nBarzane   0-12\nQuuxitude 1103\n"})
+			s3Svc.Put("testSchemas", "testformat1.json", `{"target_schema": "raw", "columns": [
+				{"name": "name", "width": 10, "datatype": "TEXT"}, {"name": "count", "width": 4, "datatype": "TEXT"}]}`)
+			svc.S3Svc = s3Svc
+
+			got, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if got.Key != "testformat1_2015-06-28.txt" || got.LoadID != "0123456789abcdef0123456789abcdef" || got.Bytes != 45 {
+				t.Errorf("unexpected result: %+v", got)
+			}
+			if got.Target != "testformat1" || got.SchemaVersion == "" || got.StartedAt.IsZero() {
+				t.Errorf("unexpected result: %+v", got)
+			}
+			if !reflect.DeepEqual(tt.want, got.Tables) {
+				t.Errorf("want: %+v, got: %+v", tt.want, got.Tables)
+			}
+			if got.Durations.Total < got.Durations.Copy || got.Durations.Total == 0 {
+				t.Errorf("unexpected durations: %+v", got.Durations)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package dataloader
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// RetryPolicy bounds how loads retry failures classified as transient. Retries back off exponentially with full
+// jitter and stop early when the next one wouldn't start before the context deadline.
+type RetryPolicy struct {
+	// Attempts made at most, the first one included. 1 disables retrying.
+	MaxAttempts int
+	// Upper bound of the delay before the first retry, doubled for every retry after it.
+	BaseDelay time.Duration
+	// Upper bound of the delay before any retry.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used for the fields of DataLoader.Retry left zero.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Returns p with its zero fields taken from DefaultRetryPolicy.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	return p
+}
+
+// Returns the delay before retrying after the passed failed attempt, picked at random up to the capped exponential
+// bound so concurrent loads don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	bound := p.MaxDelay
+	if shift := uint(attempt - 1); shift < 32 && p.BaseDelay<<shift > 0 && p.BaseDelay<<shift < bound {
+		bound = p.BaseDelay << shift
+	}
+	return time.Duration(rand.Int63n(int64(bound) + 1))
+}
+
+// Runs fn, running it again after a backoff for as long as it fails with transient errors and the retry policy and
+// ctx allow. Returns the error of the last attempt. Each retry is logged with the passed operation name.
+func (d *DataLoader) withRetry(ctx context.Context, operation string, fn func() error) error {
+	policy := d.Retry.withDefaults()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsTransient(classifyError(err)) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			level.Error(d.Logger).Log("msg", "giving up after transient failures", "operation", operation, "attempts", attempt, "err", err)
+			return err
+		}
+		delay := policy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			level.Error(d.Logger).Log("msg", "no time left to retry transient failure", "operation", operation, "attempts", attempt, "err", err)
+			return err
+		}
+		level.Warn(d.Logger).Log("msg", "retrying after transient failure",
+			"operation", operation,
+			"attempt", attempt,
+			"delay", delay,
+			"err", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-kit/kit/log"
+	"github.com/lib/pq"
+
+	"github.com/ellery44/data-loader/internal/s3test"
+)
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		errs     []error
+		timeout  time.Duration
+		attempts int
+		err      error
+	}{
+		{name: "success", attempts: 1},
+		{name: "transient-then-success", errs: []error{driver.ErrBadConn, &pq.Error{Code: "40001"}}, attempts: 3},
+		{name: "permanent", errs: []error{&DataError{errors.New("row 1 too short")}}, attempts: 1, err: errors.New("row 1 too short")},
+		{name: "unclassified", errs: []error{errors.New("boom")}, attempts: 1, err: errors.New("boom")},
+		{name: "out-of-attempts", errs: []error{driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn, driver.ErrBadConn},
+			attempts: 3, err: driver.ErrBadConn},
+		{name: "past-deadline", errs: []error{driver.ErrBadConn, driver.ErrBadConn}, timeout: time.Nanosecond,
+			attempts: 1, err: driver.ErrBadConn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &DataLoader{
+				Logger: log.NewNopLogger(),
+				Retry:  RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			}
+			ctx := context.Background()
+			if tt.timeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+				// Leave no time for any retry but let the first attempt run
+				svc.Retry.BaseDelay, svc.Retry.MaxDelay = time.Hour, time.Hour
+			}
+
+			var attempts int
+			err := svc.withRetry(ctx, "test", func() error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if (err == nil) != (tt.err == nil) || (err != nil && err.Error() != tt.err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("want attempts: %d, got: %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	bounds := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, bound := range bounds {
+		for n := 0; n < 100; n++ {
+			if delay := policy.backoff(i + 1); delay < 0 || delay > bound {
+				t.Fatalf("attempt %d, want delay in [0, %s], got: %s", i+1, bound, delay)
+			}
+		}
+	}
+	if delay := policy.backoff(80); delay < 0 || delay > policy.MaxDelay {
+		t.Errorf("want delay capped at %s, got: %s", policy.MaxDelay, delay)
+	}
+
+	if got := (RetryPolicy{MaxAttempts: 1}).withDefaults(); got.MaxAttempts != 1 || got.BaseDelay != DefaultRetryPolicy.BaseDelay {
+		t.Errorf("want defaults filled in around MaxAttempts 1, got: %+v", got)
+	}
+}
+
+// flakyExecutor fails the first fails transactions with a lost connection.
+type flakyExecutor struct {
+	*recordingExecutor
+	fails int
+}
+
+func (e *flakyExecutor) BeginTx(ctx context.Context) (Tx, error) {
+	tx, err := e.recordingExecutor.BeginTx(ctx)
+	if err == nil && e.fails > 0 {
+		e.fails--
+		return &flakyTx{tx}, nil
+	}
+	return tx, err
+}
+
+type flakyTx struct {
+	Tx
+}
+
+func (t *flakyTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	if query == "SELECT pg_last_copy_count();" {
+		return &recordedRow{err: &pq.Error{Code: "57P01", Message: "terminating connection due to administrator command"}}
+	}
+	return t.Tx.QueryRowContext(ctx, query, args...)
+}
+
+func TestLoadRetriesTransaction(t *testing.T) {
+	db := &flakyExecutor{recordingExecutor: &recordingExecutor{
+		rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{int64(1)}}},
+	}, fails: 1}
+	s3Svc := newFakeS3("testSchemas", map[string]string{"testformat1.csv": "name,width,datatype\nname,10,TEXT\n"})
+	s3Svc.Put("testDB", "testformat1_2015-06-28.txt", "Foonyor   \n")
+	svc := &DataLoader{
+		DB:           db,
+		Logger:       log.NewNopLogger(),
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc:        s3Svc,
+		Retry:        RetryPolicy{BaseDelay: time.Millisecond},
+	}
+
+	result, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStatements(t, []string{
+		"BEGIN", "SELECT", "CREATE TABLE", "COPY", "ROLLBACK",
+		"BEGIN", "SELECT", "CREATE TABLE", "COPY", "SELECT pg_last_copy_count();", "COMMIT",
+	}, db.statements)
+	if got := result.RowsLoaded(); got != 1 {
+		t.Errorf("want: 1 row loaded, got: %d", got)
+	}
+}
+
+func TestLoadRetryResetsTableResults(t *testing.T) {
+	// The first attempt creates the table and rolls back, by the second it was created by a concurrent load
+	lookups := 0
+	db := &flakyExecutor{recordingExecutor: &recordingExecutor{
+		rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{int64(1)}}},
+		answer: func(query string) [][]interface{} {
+			if !strings.HasPrefix(query, "SELECT TABLE_SCHEMA") {
+				return nil
+			}
+			if lookups++; lookups == 1 {
+				return [][]interface{}{}
+			}
+			return [][]interface{}{{"public", "name", "character varying", int64(10), nil, nil, "YES"}}
+		},
+	}, fails: 1}
+	s3Svc := newFakeS3("testSchemas", map[string]string{"testformat1.csv": "name,width,datatype\nname,10,TEXT\n"})
+	s3Svc.Put("testDB", "testformat1_2015-06-28.txt", "Foonyor   \n")
+	svc := &DataLoader{
+		DB:           db,
+		Logger:       log.NewNopLogger(),
+		DataBucket:   "testDB",
+		SchemaBucket: "testSchemas",
+		S3Svc:        s3Svc,
+		Retry:        RetryPolicy{BaseDelay: time.Millisecond},
+	}
+
+	result, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertStatements(t, []string{
+		"BEGIN", "SELECT", "CREATE TABLE", "COPY", "ROLLBACK",
+		"BEGIN", "SELECT", "COPY", "SELECT pg_last_copy_count();", "COMMIT",
+	}, db.statements)
+	want := []TableResult{{Table: "testformat1", Mode: LoadModeDirect, SourceRows: 1, RowsLoaded: 1}}
+	if !reflect.DeepEqual(want, result.Tables) {
+		t.Errorf("want: %+v, got: %+v", want, result.Tables)
+	}
+}
+
+// flakyS3 answers the first call of its operation on the data bucket with a 503 SlowDown before serving the fake.
+type flakyS3 struct {
+	*s3test.Fake
+	operation string
+	calls     int
+}
+
+func (f *flakyS3) fail(operation, bucket string) error {
+	if operation != f.operation || bucket != "testDB" {
+		return nil
+	}
+	if f.calls++; f.calls > 1 {
+		return nil
+	}
+	return awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "req-1")
+}
+
+func (f *flakyS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := f.fail("GetObject", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return f.Fake.GetObjectWithContext(ctx, input, opts...)
+}
+
+func (f *flakyS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := f.fail("PutObject", aws.StringValue(input.Bucket)); err != nil {
+		return nil, err
+	}
+	return f.Fake.PutObjectWithContext(ctx, input, opts...)
+}
+
+func TestLoadRetriesSourceFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		schemaKey string
+		schema    string
+		operation string
+	}{
+		{name: "count-in-place", schemaKey: "testformat1.csv", schema: "name,width,datatype\nname,10,TEXT\n", operation: "GetObject"},
+		{
+			name:      "transcode",
+			schemaKey: "testformat1.json",
+			schema:    `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}], "encoding": "ISO-8859-1"}`,
+			operation: "GetObject",
+		},
+		{
+			name:      "stage",
+			schemaKey: "testformat1.json",
+			schema:    `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}], "encoding": "ISO-8859-1"}`,
+			operation: "PutObject",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := &recordingExecutor{rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{int64(1)}}}}
+			s3Svc := &flakyS3{Fake: newFakeS3("testSchemas", map[string]string{test.schemaKey: test.schema}), operation: test.operation}
+			s3Svc.Put("testDB", "testformat1_2015-06-28.txt", "Foonyor   \n")
+			svc := &DataLoader{
+				DB:           db,
+				Logger:       log.NewNopLogger(),
+				DataBucket:   "testDB",
+				SchemaBucket: "testSchemas",
+				S3Svc:        s3Svc,
+				Retry:        RetryPolicy{BaseDelay: time.Millisecond},
+			}
+
+			result, err := svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s3Svc.calls < 2 {
+				t.Errorf("want: %s retried, got: %d calls", test.operation, s3Svc.calls)
+			}
+			if got := result.RowsLoaded(); got != 1 {
+				t.Errorf("want: 1 row loaded, got: %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package dataloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// tableSchema is the full definition of a target table and the layout of the files loaded into it. Schemas defined
+// as CSV only ever populate Columns, the JSON form allows the rest.
+type tableSchema struct {
+	Columns []dBColumnSchema
+	Header  *controlRecord
+	Trailer *controlRecord
+
+	// Character encoding of the data files, transcoded to UTF-8 before COPY. Empty for UTF-8.
+	Encoding string
+
+	// System columns added to every table of the schema and populated by the loader.
+	MetadataColumns []string
+
+	// Multi-record-type files carry a type code in the first RecordTypeWidth characters of every data row, routing
+	// the row to the layout and table of the matching RecordTypes entry. Columns is empty for these schemas.
+	RecordTypeWidth int
+	RecordTypes     []recordType
+
+	// Distribution and sort keys of the table. Multi-record-type schemas set these per record type instead.
+	Options tableOptions
+
+	// Redshift schema every table of the file lives in, created if missing. Empty for the default search path.
+	TargetSchema string
+
+	// ETag of the schema object the definition was read from.
+	Version string
+}
+
+// recordType is the layout of one kind of row in a multi-record-type file. Its columns describe the whole row,
+// including the type code.
+type recordType struct {
+	Code    string
+	Table   string
+	Columns []dBColumnSchema
+	Options tableOptions
+}
+
+// tableLayout pairs a redshift table with the columns loaded into it and, for multi-record-type files, the code of
+// the rows that belong to it.
+type tableLayout struct {
+	Code     string
+	Schema   string
+	Table    string
+	Columns  []dBColumnSchema
+	Metadata []string
+	Options  tableOptions
+	// Encoding of the source file, which TEXT columns are sized for once transcoded.
+	Encoding string
+}
+
+// controlRecord describes a header or trailer record sent in the same file as the fixed-width data rows.
+type controlRecord struct {
+	Fields []controlField
+
+	// Name of the field holding the number of data rows in the file.
+	RecordCountField string
+
+	// Name of the field holding the business date of the file and its Go time layout.
+	BusinessDateField  string
+	BusinessDateFormat string
+
+	// Name of the field holding a hash total and the INTEGER data column it is the sum of.
+	ControlTotalField  string
+	ControlTotalColumn string
+}
+
+type controlField struct {
+	Name  string
+	Width int
+}
+
+// hasControlRecords reports if files for this schema carry header or trailer records that need stripping before COPY.
+func (s *tableSchema) hasControlRecords() bool {
+	return s.Header != nil || s.Trailer != nil
+}
+
+// needsStaging reports if files for this schema have to be pre-processed into the staging prefix before COPY.
+func (s *tableSchema) needsStaging() bool {
+	if s.hasControlRecords() || len(s.RecordTypes) != 0 || s.Encoding != encodingUTF8 {
+		return true
+	}
+	for _, col := range s.Columns {
+		if col.needsConversion() {
+			return true
+		}
+	}
+	return false
+}
+
+// tableLayouts lists every table files for this schema load into. Single layout schemas load into the table named
+// after the file.
+func (s *tableSchema) tableLayouts(targetName string) []tableLayout {
+	if len(s.RecordTypes) == 0 {
+		return []tableLayout{{
+			Schema:   s.TargetSchema,
+			Table:    targetName,
+			Columns:  s.Columns,
+			Metadata: s.MetadataColumns,
+			Options:  s.Options,
+			Encoding: s.Encoding,
+		}}
+	}
+	layouts := make([]tableLayout, 0, len(s.RecordTypes))
+	for _, rt := range s.RecordTypes {
+		layouts = append(layouts, tableLayout{
+			Code:     rt.Code,
+			Schema:   s.TargetSchema,
+			Table:    rt.Table,
+			Columns:  rt.Columns,
+			Metadata: s.MetadataColumns,
+			Options:  rt.Options,
+			Encoding: s.Encoding,
+		})
+	}
+	return layouts
+}
+
+// qualifiedTable is the layout's table name qualified with its schema, if it has one.
+func (l tableLayout) qualifiedTable() string {
+	return qualifiedTableName(l.Schema, l.Table)
+}
+
+// JSON Schema Format ------------------------
+
+type jsonTableSchema struct {
+	Columns         []jsonColumn       `json:"columns"`
+	Header          *jsonControlRecord `json:"header"`
+	Trailer         *jsonControlRecord `json:"trailer"`
+	Encoding        string             `json:"encoding"`
+	MetadataColumns []string           `json:"metadata_columns"`
+	RecordTypeWidth int                `json:"record_type_width"`
+	RecordTypes     []jsonRecordType   `json:"record_types"`
+	TargetSchema    string             `json:"target_schema"`
+	// Only decoded to be rejected: tables are loaded into the database the loader connects to
+	Database *string `json:"database"`
+	jsonTableOptions
+}
+
+type jsonRecordType struct {
+	Code    string       `json:"code"`
+	Table   string       `json:"table"`
+	Columns []jsonColumn `json:"columns"`
+	jsonTableOptions
+}
+
+type jsonTableOptions struct {
+	DistStyle    string   `json:"diststyle"`
+	DistKey      string   `json:"distkey"`
+	SortKey      []string `json:"sortkey"`
+	SortKeyStyle string   `json:"sortkey_style"`
+}
+
+type jsonColumn struct {
+	Name       string   `json:"name"`
+	Width      int      `json:"width"`
+	DataType   string   `json:"datatype"`
+	Scale      int      `json:"scale"`
+	Sign       string   `json:"sign"`
+	Transforms []string `json:"transforms"`
+	Encode     string   `json:"encode"`
+}
+
+type jsonControlRecord struct {
+	Fields             []jsonControlField `json:"fields"`
+	RecordCountField   string             `json:"record_count_field"`
+	BusinessDateField  string             `json:"business_date_field"`
+	BusinessDateFormat string             `json:"business_date_format"`
+	ControlTotalField  string             `json:"control_total_field"`
+	ControlTotalColumn string             `json:"control_total_column"`
+}
+
+type jsonControlField struct {
+	Name  string `json:"name"`
+	Width int    `json:"width"`
+}
+
+// Converts a JSON table definition into a tableSchema, validating the header and trailer layouts against it.
+func unmarshalTableDefinition(rawSchema io.Reader) (*tableSchema, error) {
+	var def jsonTableSchema
+	if err := json.NewDecoder(rawSchema).Decode(&def); err != nil {
+		return nil, err
+	}
+	schema := &tableSchema{
+		Columns:         toColumnSchemas(def.Columns),
+		RecordTypeWidth: def.RecordTypeWidth,
+		Options:         def.jsonTableOptions.toTableOptions(),
+		TargetSchema:    def.TargetSchema,
+	}
+	if err := def.validateRecordTypes(); err != nil {
+		return nil, err
+	}
+	if def.Database != nil {
+		return nil, &ConfigError{errors.New("database is not supported in table definitions, tables are loaded into the " +
+			"database the loader connects to, deploy a loader per database instead")}
+	}
+	if err := validateTargetSchema(def.TargetSchema); err != nil {
+		return nil, err
+	}
+	var err error
+	if schema.Encoding, err = parseEncoding(def.Encoding); err != nil {
+		return nil, err
+	}
+	for _, rt := range def.RecordTypes {
+		schema.RecordTypes = append(schema.RecordTypes, recordType{
+			Code:    rt.Code,
+			Table:   rt.Table,
+			Columns: toColumnSchemas(rt.Columns),
+			Options: rt.jsonTableOptions.toTableOptions(),
+		})
+	}
+	if schema.Header, err = def.Header.toControlRecord(schema.Columns); err != nil {
+		return nil, fmt.Errorf("invalid header record: %v", err)
+	}
+	if schema.Trailer, err = def.Trailer.toControlRecord(schema.Columns); err != nil {
+		return nil, fmt.Errorf("invalid trailer record: %v", err)
+	}
+	schema.MetadataColumns = def.MetadataColumns
+	if err = validateMetadataColumns(schema.MetadataColumns, schema.tableLayouts("")); err != nil {
+		return nil, err
+	}
+	for _, layout := range schema.tableLayouts("") {
+		for _, col := range layout.Columns {
+			if _, err = validateTransforms(col); err != nil {
+				return nil, err
+			}
+			if err = validateColumnEncoding(col); err != nil {
+				return nil, err
+			}
+		}
+	}
+	layouts := schema.tableLayouts("")
+	if len(schema.RecordTypes) == 0 {
+		if err = schema.Options.validate(layouts[0]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range schema.RecordTypes {
+		if err = schema.RecordTypes[i].Options.validate(layouts[i]); err != nil {
+			return nil, fmt.Errorf("record type %q: %v", layouts[i].Code, err)
+		}
+	}
+	return schema, nil
+}
+
+func (o jsonTableOptions) toTableOptions() tableOptions {
+	return tableOptions{
+		DistStyle:    o.DistStyle,
+		DistKey:      o.DistKey,
+		SortKey:      o.SortKey,
+		SortKeyStyle: o.SortKeyStyle,
+	}
+}
+
+func toColumnSchemas(columns []jsonColumn) []dBColumnSchema {
+	var dbColumns []dBColumnSchema
+	for _, col := range columns {
+		dbColumns = append(dbColumns, dBColumnSchema{
+			Name:       col.Name,
+			Width:      strconv.Itoa(col.Width),
+			DataType:   col.DataType,
+			Scale:      col.Scale,
+			Sign:       col.Sign,
+			Transforms: col.Transforms,
+			Encode:     strings.ToLower(col.Encode),
+		})
+	}
+	return dbColumns
+}
+
+func (def *jsonTableSchema) validateRecordTypes() error {
+	if len(def.RecordTypes) == 0 {
+		if def.RecordTypeWidth != 0 {
+			return fmt.Errorf("record_type_width set without any record_types")
+		}
+		return nil
+	}
+	if def.RecordTypeWidth <= 0 {
+		return fmt.Errorf("invalid record_type_width %d", def.RecordTypeWidth)
+	}
+	if len(def.Columns) != 0 {
+		return fmt.Errorf("columns and record_types can't both be defined")
+	}
+	if o := def.jsonTableOptions; o.DistStyle != "" || o.DistKey != "" || len(o.SortKey) != 0 || o.SortKeyStyle != "" {
+		return fmt.Errorf("table options must be set on each record type, not the whole schema")
+	}
+	for _, rec := range []*jsonControlRecord{def.Header, def.Trailer} {
+		if rec != nil && rec.ControlTotalField != "" {
+			return fmt.Errorf("control totals are not supported with record_types")
+		}
+	}
+	codes := make(map[string]struct{})
+	tables := make(map[string]struct{})
+	for _, rt := range def.RecordTypes {
+		if len(rt.Code) != def.RecordTypeWidth {
+			return fmt.Errorf("record type code %q is not %d characters wide", rt.Code, def.RecordTypeWidth)
+		}
+		if _, ok := codes[rt.Code]; ok {
+			return fmt.Errorf("duplicate record type code %q", rt.Code)
+		}
+		codes[rt.Code] = struct{}{}
+		if rt.Table == "" {
+			return fmt.Errorf("record type %q has no table", rt.Code)
+		}
+		if _, ok := tables[rt.Table]; ok {
+			return fmt.Errorf("duplicate record type table %s", rt.Table)
+		}
+		tables[rt.Table] = struct{}{}
+	}
+	return nil
+}
+
+func (r *jsonControlRecord) toControlRecord(columns []dBColumnSchema) (*controlRecord, error) {
+	if r == nil {
+		return nil, nil
+	}
+	if len(r.Fields) == 0 {
+		return nil, fmt.Errorf("no fields defined")
+	}
+	rec := &controlRecord{
+		RecordCountField:   r.RecordCountField,
+		BusinessDateField:  r.BusinessDateField,
+		BusinessDateFormat: r.BusinessDateFormat,
+		ControlTotalField:  r.ControlTotalField,
+		ControlTotalColumn: r.ControlTotalColumn,
+	}
+	if rec.BusinessDateField != "" && rec.BusinessDateFormat == "" {
+		rec.BusinessDateFormat = defaultDateFormat
+	}
+	set := make(map[string]struct{})
+	for _, f := range r.Fields {
+		if f.Width <= 0 {
+			return nil, fmt.Errorf("field %s has invalid width %d", f.Name, f.Width)
+		}
+		if _, ok := set[f.Name]; ok {
+			return nil, fmt.Errorf("duplicate field name %s", f.Name)
+		}
+		set[f.Name] = struct{}{}
+		rec.Fields = append(rec.Fields, controlField{Name: f.Name, Width: f.Width})
+	}
+	for _, name := range []string{rec.RecordCountField, rec.BusinessDateField, rec.ControlTotalField} {
+		if _, ok := set[name]; name != "" && !ok {
+			return nil, fmt.Errorf("referenced field %s is not defined", name)
+		}
+	}
+	if (rec.ControlTotalField == "") != (rec.ControlTotalColumn == "") {
+		return nil, fmt.Errorf("control_total_field and control_total_column must be set together")
+	}
+	if rec.ControlTotalColumn != "" {
+		found := false
+		for _, col := range columns {
+			if col.Name == rec.ControlTotalColumn && col.DataType == "INTEGER" {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("control total column %s is not an INTEGER column", rec.ControlTotalColumn)
+		}
+	}
+	return rec, nil
+}
@@ -0,0 +1,211 @@
+package dataloader
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalTableDefinition(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawSchema string
+		err       error
+		want      *tableSchema
+	}{
+		{
+			name: "happy-path",
+			rawSchema: `{
+				"columns": [
+					{"name": "name", "width": 10, "datatype": "TEXT"},
+					{"name": "count", "width": 3, "datatype": "INTEGER"}
+				],
+				"header": {
+					"fields": [{"name": "type", "width": 3}, {"name": "date", "width": 8}],
+					"business_date_field": "date"
+				},
+				"trailer": {
+					"fields": [{"name": "type", "width": 3}, {"name": "rows", "width": 9}, {"name": "total", "width": 9}],
+					"record_count_field": "rows",
+					"control_total_field": "total",
+					"control_total_column": "count"
+				}
+			}`,
+			want: &tableSchema{
+				Columns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "3", Name: "count", DataType: "INTEGER"},
+				},
+				Header: &controlRecord{
+					Fields:             []controlField{{Name: "type", Width: 3}, {Name: "date", Width: 8}},
+					BusinessDateField:  "date",
+					BusinessDateFormat: defaultDateFormat,
+				},
+				Trailer: &controlRecord{
+					Fields:             []controlField{{Name: "type", Width: 3}, {Name: "rows", Width: 9}, {Name: "total", Width: 9}},
+					RecordCountField:   "rows",
+					ControlTotalField:  "total",
+					ControlTotalColumn: "count",
+				},
+			},
+		},
+		{
+			name:      "columns-only",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}]}`,
+			want: &tableSchema{
+				Columns: []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}},
+			},
+		},
+		{
+			name: "record-types",
+			rawSchema: `{
+				"record_type_width": 2,
+				"record_types": [
+					{"code": "01", "table": "orders", "columns": [{"name": "type", "width": 2, "datatype": "TEXT"}]},
+					{"code": "02", "table": "order_lines", "columns": [{"name": "type", "width": 2, "datatype": "TEXT"}]}
+				]
+			}`,
+			want: &tableSchema{
+				RecordTypeWidth: 2,
+				RecordTypes: []recordType{
+					{Code: "01", Table: "orders", Columns: []dBColumnSchema{{Width: "2", Name: "type", DataType: "TEXT"}}},
+					{Code: "02", Table: "order_lines", Columns: []dBColumnSchema{{Width: "2", Name: "type", DataType: "TEXT"}}},
+				},
+			},
+		},
+		{
+			name:      "record-type-code-wrong-width",
+			rawSchema: `{"record_type_width": 2, "record_types": [{"code": "1", "table": "orders"}]}`,
+			err:       errors.New("record type code \"1\" is not 2 characters wide"),
+		},
+		{
+			name: "record-type-duplicate-table",
+			rawSchema: `{"record_type_width": 1, "record_types": [
+				{"code": "1", "table": "orders"}, {"code": "2", "table": "orders"}]}`,
+			err: errors.New("duplicate record type table orders"),
+		},
+		{
+			name: "record-types-with-columns",
+			rawSchema: `{"record_type_width": 1, "record_types": [{"code": "1", "table": "orders"}],
+				"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}]}`,
+			err: errors.New("columns and record_types can't both be defined"),
+		},
+		{
+			name:      "encoding",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}], "encoding": "ISO-8859-1"}`,
+			want: &tableSchema{
+				Columns:  []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}},
+				Encoding: encodingLatin1,
+			},
+		},
+		{
+			name:      "metadata-columns",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}], "metadata_columns": ["source_file", "load_id"]}`,
+			want: &tableSchema{
+				Columns:         []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}},
+				MetadataColumns: []string{"source_file", "load_id"},
+			},
+		},
+		{
+			name:      "unknown-metadata-column",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}], "metadata_columns": ["row_id"]}`,
+			err:       errors.New("unknown metadata column row_id"),
+		},
+		{
+			name:      "unsupported-encoding",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}], "encoding": "shift-jis"}`,
+			err:       errors.New("unsupported encoding shift-jis"),
+		},
+		{
+			name:      "undefined-count-field",
+			rawSchema: `{"columns": [], "trailer": {"fields": [{"name": "rows", "width": 9}], "record_count_field": "cnt"}}`,
+			err:       errors.New("invalid trailer record: referenced field cnt is not defined"),
+		},
+		{
+			name:      "no-fields",
+			rawSchema: `{"columns": [], "header": {"fields": []}}`,
+			err:       errors.New("invalid header record: no fields defined"),
+		},
+		{
+			name:      "bad-field-width",
+			rawSchema: `{"columns": [], "header": {"fields": [{"name": "type", "width": 0}]}}`,
+			err:       errors.New("invalid header record: field type has invalid width 0"),
+		},
+		{
+			name: "control-total-on-text-column",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT"}],
+				"trailer": {"fields": [{"name": "total", "width": 9}], "control_total_field": "total", "control_total_column": "name"}}`,
+			err: errors.New("invalid trailer record: control total column name is not an INTEGER column"),
+		},
+		{
+			name:      "transforms",
+			rawSchema: `{"columns": [{"name": "opened", "width": 8, "datatype": "TEXT", "transforms": ["trim", "date:YYYYMMDD"]}]}`,
+			want: &tableSchema{
+				Columns: []dBColumnSchema{{Width: "8", Name: "opened", DataType: "TEXT", Transforms: []string{"trim", "date:YYYYMMDD"}}},
+			},
+		},
+		{
+			name:      "unknown-transform",
+			rawSchema: `{"columns": [{"name": "name", "width": 10, "datatype": "TEXT", "transforms": ["titlecase"]}]}`,
+			err:       errors.New("column name: unknown transform titlecase"),
+		},
+		{
+			name: "table-options",
+			rawSchema: `{"columns": [{"name": "account", "width": 10, "datatype": "TEXT", "encode": "ZSTD"}],
+				"distkey": "account", "sortkey": ["account"]}`,
+			want: &tableSchema{
+				Columns: []dBColumnSchema{{Width: "10", Name: "account", DataType: "TEXT", Encode: "zstd"}},
+				Options: tableOptions{DistStyle: "KEY", DistKey: "account", SortKey: []string{"account"}, SortKeyStyle: "COMPOUND"},
+			},
+		},
+		{
+			name:      "target-schema",
+			rawSchema: `{"target_schema": "raw_vendor_x", "columns": [{"name": "name", "width": 10, "datatype": "TEXT"}]}`,
+			want: &tableSchema{
+				Columns:      []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}},
+				TargetSchema: "raw_vendor_x",
+			},
+		},
+		{
+			name:      "invalid-target-schema",
+			rawSchema: `{"target_schema": "raw-vendor", "columns": [{"name": "name", "width": 10, "datatype": "TEXT"}]}`,
+			err:       errors.New(`invalid target_schema "raw-vendor"`),
+		},
+		{
+			name:      "database-rejected",
+			rawSchema: `{"database": "vendor_x", "columns": [{"name": "name", "width": 10, "datatype": "TEXT"}]}`,
+			err: errors.New("database is not supported in table definitions, tables are loaded into the database the " +
+				"loader connects to, deploy a loader per database instead"),
+		},
+		{
+			name: "record-type-undefined-sortkey",
+			rawSchema: `{"record_type_width": 2, "record_types": [
+				{"code": "01", "table": "orders", "columns": [{"name": "type", "width": 2, "datatype": "TEXT"}], "sortkey": ["id"]}]}`,
+			err: errors.New(`record type "01": sortkey column id is not defined`),
+		},
+		{
+			name: "record-types-with-schema-options",
+			rawSchema: `{"record_type_width": 2, "distkey": "type", "record_types": [
+				{"code": "01", "table": "orders", "columns": [{"name": "type", "width": 2, "datatype": "TEXT"}]}]}`,
+			err: errors.New("table options must be set on each record type, not the whole schema"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unmarshalTableDefinition(strings.NewReader(tt.rawSchema))
+			if tt.err != nil {
+				if err == nil || tt.err.Error() != err.Error() {
+					t.Errorf("want: %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tt.want, got) {
+				t.Errorf("want: %+v, got: %+v", tt.want, got)
+			}
+		})
+	}
+}
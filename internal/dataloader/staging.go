@@ -0,0 +1,337 @@
+package dataloader
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/go-kit/kit/log/level"
+)
+
+// StagingPrefix is the key prefix in the data bucket that pre-processed copies of data files are written under for
+// COPY to read from. Objects under it are never loaded directly.
+const StagingPrefix = "staging/"
+
+// IsStagingKey reports if the passed data bucket key is a staged copy written by the loader itself.
+func IsStagingKey(key string) bool {
+	return strings.HasPrefix(key, StagingPrefix)
+}
+
+// sourceFile tracks a data file through pre-processing into the objects COPY actually reads.
+type sourceFile struct {
+	// Key of the object as it was dropped into the data bucket.
+	Key string
+	// Business date of the file, taken from its control records or else its name.
+	PartitionDate time.Time
+	// Size of the file in bytes.
+	Bytes int64
+	// Identifies this load of the file and when it ran.
+	LoadID   string
+	LoadedAt time.Time
+	// One COPY per table the file loads into.
+	Targets []copyTarget
+}
+
+// copyTarget is a single COPY of an object into a table.
+type copyTarget struct {
+	Schema  string
+	Table   string
+	Columns []dBColumnSchema
+	// Layout of the object COPY reads, which differs from Columns when values were converted while staging.
+	CopyColumns []dBColumnSchema
+	// Metadata columns to populate. When set, or when columns declare transforms, the COPY goes through a temporary
+	// staging table first.
+	Metadata []string
+	// Key COPY reads from. Differs from the source file's key when the file had to be staged.
+	CopyKey string
+	// Number of data rows COPY is expected to load.
+	Rows int64
+	// Encoding of the source file, which TEXT columns are sized for once transcoded.
+	Encoding string
+}
+
+// qualifiedTable is the target table name qualified with its schema, if it has one.
+func (t copyTarget) qualifiedTable() string {
+	return qualifiedTableName(t.Schema, t.Table)
+}
+
+// copyTable is the table COPY loads into, the temporary staging table for targets needing one. Temporary tables live
+// in their own session schema so are never qualified.
+func (t copyTarget) copyTable() string {
+	if t.viaStagingTable() {
+		return t.Table + "_staging"
+	}
+	return t.qualifiedTable()
+}
+
+// viaStagingTable reports if the target has to be COPYed into a staging table and inserted from there.
+func (t copyTarget) viaStagingTable() bool {
+	return len(t.Metadata) != 0 || hasTransforms(t.Columns)
+}
+
+// Gets the data file ready for COPY, retrying transient S3 failures. Files that need no pre-processing are only
+// counted and loaded in place, others are rewritten into the staging prefix: transcoded to UTF-8, control records
+// stripped, split per table for multi-record-type files and numeric fields converted.
+func (d *DataLoader) prepareSourceFile(ctx context.Context, fileName, targetName string, schema *tableSchema) (source *sourceFile, err error) {
+	// A failed attempt removes what it staged, so every attempt reads the data file from the start
+	err = d.withRetry(ctx, "prepare source file", func() error {
+		source, err = d.prepareSourceFileOnce(ctx, fileName, targetName, schema)
+		return err
+	})
+	return source, err
+}
+
+func (d *DataLoader) prepareSourceFileOnce(ctx context.Context, fileName, targetName string, schema *tableSchema) (_ *sourceFile, err error) {
+	now, loadID := time.Now, newLoadID
+	if d.now != nil {
+		now = d.now
+	}
+	if d.loadID != nil {
+		loadID = d.loadID
+	}
+	source := &sourceFile{Key: fileName, LoadID: loadID(), LoadedAt: now().UTC()}
+	source.PartitionDate, _ = parseFileDate(fileName)
+	defer func() {
+		// Don't leave behind parts already staged when a later one fails
+		if err != nil {
+			d.cleanupSourceFile(ctx, source)
+		}
+	}()
+
+	if !schema.needsStaging() {
+		rows, size, err := d.countSourceRows(ctx, fileName)
+		if err != nil {
+			return nil, err
+		}
+		source.Bytes = size
+		source.Targets = []copyTarget{{
+			Schema:      schema.TargetSchema,
+			Table:       targetName,
+			Columns:     schema.Columns,
+			CopyColumns: schema.Columns,
+			Metadata:    schema.MetadataColumns,
+			CopyKey:     fileName,
+			Rows:        rows,
+		}}
+		return source, nil
+	}
+
+	dataRsp, err := d.S3Svc.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(d.DataBucket),
+		Key:    aws.String(fileName),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer dataRsp.Body.Close()
+	source.Bytes = aws.Int64Value(dataRsp.ContentLength)
+
+	data := transcode(dataRsp.Body, schema.Encoding)
+	if schema.hasControlRecords() {
+		stripped, err := newTempFile()
+		if err != nil {
+			return nil, err
+		}
+		defer stripped.Close()
+
+		summary, err := stripControlRecords(data, stripped, schema)
+		if err != nil {
+			return nil, &DataError{err}
+		}
+		if !summary.BusinessDate.IsZero() {
+			source.PartitionDate = summary.BusinessDate
+		}
+		level.Info(d.Logger).Log("msg", "stripped control records",
+			"file_name", fileName,
+			"source_rows", summary.Rows,
+			"partition_date", source.PartitionDate.Format("2006-01-02"))
+
+		if _, err = stripped.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		data = stripped
+	}
+
+	// Write the rows of each table into their own part, converting them on the way
+	layouts := schema.tableLayouts(targetName)
+	parts := make(map[string]*tempFile, len(layouts))
+	sinks := make(map[string]rowSink, len(layouts))
+	for _, layout := range layouts {
+		part, err := newTempFile()
+		if err != nil {
+			return nil, err
+		}
+		defer part.Close()
+		converter, err := newRowConverter(layout.Columns)
+		if err != nil {
+			return nil, &SchemaError{err}
+		}
+		parts[layout.Code] = part
+		sinks[layout.Code] = newPartSink(part, converter)
+	}
+	rows, err := splitRecordTypes(data, schema.RecordTypeWidth, sinks)
+	if err != nil {
+		return nil, &DataError{err}
+	}
+
+	for _, layout := range layouts {
+		level.Info(d.Logger).Log("msg", "pre-processed rows",
+			"file_name", fileName,
+			"record_type", layout.Code,
+			"table_name", layout.Table,
+			"source_rows", rows[layout.Code])
+		if rows[layout.Code] == 0 && len(layouts) > 1 {
+			continue
+		}
+		copyColumns, err := stagedColumns(layout.Columns)
+		if err != nil {
+			return nil, &SchemaError{err}
+		}
+		if _, err = parts[layout.Code].Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		stagingKey := fileName
+		if len(schema.RecordTypes) != 0 {
+			stagingKey = layout.Table + "/" + fileName
+		}
+		stagedKey, err := d.stageObject(ctx, stagingKey, parts[layout.Code])
+		if err != nil {
+			return nil, err
+		}
+		source.Targets = append(source.Targets, copyTarget{
+			Schema:      layout.Schema,
+			Table:       layout.Table,
+			Columns:     layout.Columns,
+			CopyColumns: copyColumns,
+			Metadata:    layout.Metadata,
+			CopyKey:     stagedKey,
+			Rows:        rows[layout.Code],
+			Encoding:    layout.Encoding,
+		})
+	}
+	return source, nil
+}
+
+// rowSink receives the rows of a file routed to one table.
+type rowSink func(row string) error
+
+// Returns a sink writing rows into part, passing them through converter first when there is one.
+func newPartSink(part io.Writer, converter *rowConverter) rowSink {
+	return func(row string) error {
+		if converter != nil {
+			var err error
+			if row, err = converter.convert(row); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(part, row)
+		return err
+	}
+}
+
+// Routes each row of a file to the sink for its type code and returns the rows routed per code. With a codeWidth of 0
+// every row goes to the sink for the empty code.
+func splitRecordTypes(r io.Reader, codeWidth int, sinks map[string]rowSink) (map[string]int64, error) {
+	rows := make(map[string]int64, len(sinks))
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		row, err := br.ReadString('\n')
+		if row != "" {
+			chars := []rune(row)
+			if len(chars) < codeWidth {
+				return nil, fmt.Errorf("row %d too short for record type code", line)
+			}
+			code := string(chars[:codeWidth])
+			sink, ok := sinks[code]
+			if !ok {
+				return nil, fmt.Errorf("row %d has unknown record type %q", line, code)
+			}
+			if err := sink(row); err != nil {
+				return nil, fmt.Errorf("row %d: %v", line, err)
+			}
+			rows[code]++
+		}
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Creates a scratch file that is removed from disk as soon as it is closed.
+func newTempFile() (*tempFile, error) {
+	f, err := ioutil.TempFile("", "data-loader-")
+	if err != nil {
+		return nil, err
+	}
+	return &tempFile{f}, nil
+}
+
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// Writes body into the staging prefix of the data bucket under the passed key and returns the staged key.
+func (d *DataLoader) stageObject(ctx context.Context, key string, body io.ReadSeeker) (string, error) {
+	stagedKey := StagingPrefix + key
+	_, err := d.S3Svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(d.DataBucket),
+		Key:    aws.String(stagedKey),
+		Body:   body,
+	})
+	if err != nil {
+		return "", err
+	}
+	level.Debug(d.Logger).Log("msg", "staged object", "data_bucket", d.DataBucket, "staged_key", stagedKey)
+	return stagedKey, nil
+}
+
+// Removes any staged copy made for source. Failures are only logged since the load itself is already decided.
+func (d *DataLoader) cleanupSourceFile(ctx context.Context, source *sourceFile) {
+	if source == nil {
+		return
+	}
+	for _, target := range source.Targets {
+		if target.CopyKey == source.Key {
+			continue
+		}
+		_, err := d.S3Svc.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(d.DataBucket),
+			Key:    aws.String(target.CopyKey),
+		})
+		if err != nil {
+			level.Warn(d.Logger).Log("msg", "failed to remove staged object", "staged_key", target.CopyKey, "err", err)
+		}
+	}
+}
+
+// Parses the date out of data file names following the <target>_<YYYY-MM-DD>.<ext> convention.
+func parseFileDate(fileName string) (time.Time, bool) {
+	base := path.Base(fileName)
+	i := strings.Index(base, "_")
+	if i < 0 {
+		return time.Time{}, false
+	}
+	datePart := strings.TrimSuffix(base[i+1:], path.Ext(base))
+	fileDate, err := time.Parse("2006-01-02", datePart)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fileDate, true
+}
@@ -0,0 +1,240 @@
+package dataloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestParseFileDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		want     time.Time
+		ok       bool
+	}{
+		{name: "happy-path", fileName: "testformat1_2015-06-28.txt", want: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC), ok: true},
+		{name: "no-date", fileName: "testformat1.txt"},
+		{name: "bad-date", fileName: "testformat1_june.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseFileDate(tt.fileName)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("want: %v %v, got: %v %v", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestPrepareSourceFile(t *testing.T) {
+	const fileName = "testformat1_2015-06-28.txt"
+	data := "Foonyor   1  1\nBarzane   0-12\nQuuxitude 1103\n"
+	columns := []dBColumnSchema{
+		{Width: "10", Name: "name", DataType: "TEXT"},
+		{Width: "1", Name: "valid", DataType: "BOOLEAN"},
+		{Width: "3", Name: "count", DataType: "INTEGER"},
+	}
+	orderColumns := []dBColumnSchema{
+		{Width: "2", Name: "type", DataType: "TEXT"},
+		{Width: "4", Name: "order_id", DataType: "TEXT"},
+	}
+	lineColumns := []dBColumnSchema{
+		{Width: "2", Name: "type", DataType: "TEXT"},
+		{Width: "4", Name: "order_id", DataType: "TEXT"},
+		{Width: "1", Name: "item", DataType: "TEXT"},
+	}
+	tests := []struct {
+		name       string
+		schema     *tableSchema
+		input      string
+		want       []copyTarget
+		wantStaged map[string]string
+		wantDate   time.Time
+	}{
+		{
+			name:     "loaded-in-place",
+			schema:   &tableSchema{Columns: columns},
+			input:    data,
+			want:     []copyTarget{{Table: "testformat1", Columns: columns, CopyColumns: columns, CopyKey: fileName, Rows: 3}},
+			wantDate: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "control-records-staged",
+			schema: &tableSchema{
+				Columns: columns,
+				Header: &controlRecord{
+					Fields:             []controlField{{Name: "date", Width: 8}},
+					BusinessDateField:  "date",
+					BusinessDateFormat: defaultDateFormat,
+				},
+				Trailer: &controlRecord{
+					Fields:           []controlField{{Name: "rows", Width: 3}},
+					RecordCountField: "rows",
+				},
+			},
+			input:      "20150627\n" + data + "003\n",
+			want:       []copyTarget{{Table: "testformat1", Columns: columns, CopyColumns: columns, CopyKey: StagingPrefix + fileName, Rows: 3}},
+			wantStaged: map[string]string{StagingPrefix + fileName: data},
+			wantDate:   time.Date(2015, 6, 27, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "decimals-converted",
+			schema: &tableSchema{
+				Columns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "5", Name: "amount", DataType: "DECIMAL", Scale: 2, Sign: signOverpunch},
+				},
+			},
+			input: "Foonyor   1234E\nBarzane   0001}\n",
+			want: []copyTarget{{
+				Table: "testformat1",
+				Columns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "5", Name: "amount", DataType: "DECIMAL", Scale: 2, Sign: signOverpunch},
+				},
+				CopyColumns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "7", Name: "amount", DataType: "DECIMAL"},
+				},
+				CopyKey: StagingPrefix + fileName,
+				Rows:    2,
+			}},
+			wantStaged: map[string]string{StagingPrefix + fileName: "Foonyor   +123.45\nBarzane   -000.10\n"},
+			wantDate:   time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "latin1-transcoded",
+			schema: &tableSchema{
+				Columns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "5", Name: "amount", DataType: "DECIMAL", Scale: 2},
+				},
+				Encoding: encodingLatin1,
+			},
+			input: "Caf\xe9      12345\n",
+			want: []copyTarget{{
+				Table: "testformat1",
+				Columns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "5", Name: "amount", DataType: "DECIMAL", Scale: 2},
+				},
+				CopyColumns: []dBColumnSchema{
+					{Width: "10", Name: "name", DataType: "TEXT"},
+					{Width: "7", Name: "amount", DataType: "DECIMAL"},
+				},
+				CopyKey:  StagingPrefix + fileName,
+				Rows:     1,
+				Encoding: encodingLatin1,
+			}},
+			wantStaged: map[string]string{StagingPrefix + fileName: "Café      +123.45\n"},
+			wantDate:   time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "record-types-split",
+			schema: &tableSchema{
+				Trailer: &controlRecord{
+					Fields:           []controlField{{Name: "rows", Width: 3}},
+					RecordCountField: "rows",
+				},
+				RecordTypeWidth: 2,
+				RecordTypes: []recordType{
+					{Code: "01", Table: "orders", Columns: orderColumns},
+					{Code: "02", Table: "order_lines", Columns: lineColumns},
+					{Code: "03", Table: "order_notes", Columns: lineColumns},
+				},
+			},
+			input: "01A001\n02A001X\n02A001Y\n01A002\n004\n",
+			want: []copyTarget{
+				{Table: "orders", Columns: orderColumns, CopyColumns: orderColumns, CopyKey: StagingPrefix + "orders/" + fileName, Rows: 2},
+				{Table: "order_lines", Columns: lineColumns, CopyColumns: lineColumns, CopyKey: StagingPrefix + "order_lines/" + fileName, Rows: 2},
+			},
+			wantStaged: map[string]string{
+				StagingPrefix + "orders/" + fileName:      "01A001\n01A002\n",
+				StagingPrefix + "order_lines/" + fileName: "02A001X\n02A001Y\n",
+			},
+			wantDate: time.Date(2015, 6, 28, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Svc := newFakeS3("testDB", map[string]string{fileName: tt.input})
+			svc := &DataLoader{
+				DataBucket: "testDB",
+				Logger:     log.NewNopLogger(),
+				S3Svc:      s3Svc,
+			}
+			got, err := svc.prepareSourceFile(context.Background(), fileName, "testformat1", tt.schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got.Targets, tt.want) || !got.PartitionDate.Equal(tt.wantDate) {
+				t.Errorf("want: %+v %v, got: %+v", tt.want, tt.wantDate, got)
+			}
+			for key, want := range tt.wantStaged {
+				if got, _ := s3Svc.Object("testDB", key); got != want {
+					t.Errorf("want staged %s: %q, got: %q", key, want, got)
+				}
+			}
+
+			svc.cleanupSourceFile(context.Background(), got)
+			for key := range tt.wantStaged {
+				if _, ok := s3Svc.Object("testDB", key); ok {
+					t.Errorf("staged object %s was not cleaned up", key)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitRecordTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+		want  map[string]string
+	}{
+		{
+			name:  "happy-path",
+			input: "01A\n02B\n01C",
+			want:  map[string]string{"01": "01A\n01C", "02": "02B\n"},
+		},
+		{
+			name:  "unknown-type",
+			input: "01A\n09B\n",
+			err:   errors.New("row 2 has unknown record type \"09\""),
+		},
+		{
+			name:  "short-row",
+			input: "01A\n0",
+			err:   errors.New("row 2 too short for record type code"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bufs := map[string]*bytes.Buffer{"01": {}, "02": {}}
+			sinks := map[string]rowSink{"01": newPartSink(bufs["01"], nil), "02": newPartSink(bufs["02"], nil)}
+			_, err := splitRecordTypes(strings.NewReader(tt.input), 2, sinks)
+			if tt.err != nil {
+				if err == nil || tt.err.Error() != err.Error() {
+					t.Errorf("want: %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for code, want := range tt.want {
+				if bufs[code].String() != want {
+					t.Errorf("want %s: %q, got: %q", code, want, bufs[code].String())
+				}
+			}
+		})
+	}
+}
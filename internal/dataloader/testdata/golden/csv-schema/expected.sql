@@ -0,0 +1,6 @@
+BEGIN
+SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), CURRENT_SCHEMA()) AND TABLE_NAME = $2 ORDER BY ORDINAL_POSITION; -- $1 = "" -- $2 = "testformat1"
+CREATE TABLE testformat1( name VARCHAR(10), valid BOOLEAN, count INTEGER);
+COPY testformat1 FROM 's3://testDB/testformat1_2015-06-28.txt' IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy-test-us-west-2' FIXEDWIDTH 'name:10, valid:1, count:3';
+SELECT pg_last_copy_count();
+COMMIT
@@ -0,0 +1,6 @@
+BEGIN
+SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), CURRENT_SCHEMA()) AND TABLE_NAME = $2 ORDER BY ORDINAL_POSITION; -- $1 = "" -- $2 = "ledger"
+CREATE TABLE ledger( account VARCHAR(6), units INTEGER, amount DECIMAL(7,2));
+COPY ledger FROM 's3://testDB/staging/ledger_2018-11-14.txt' IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy-test-us-west-2' FIXEDWIDTH 'account:6, units:3, amount:9';
+SELECT pg_last_copy_count();
+COMMIT
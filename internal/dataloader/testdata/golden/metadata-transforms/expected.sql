@@ -0,0 +1,10 @@
+BEGIN
+CREATE SCHEMA IF NOT EXISTS raw_vendor_x;
+SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), CURRENT_SCHEMA()) AND TABLE_NAME = $2 ORDER BY ORDINAL_POSITION; -- $1 = "raw_vendor_x" -- $2 = "accounts"
+CREATE TABLE raw_vendor_x.accounts( account VARCHAR(10) ENCODE ZSTD, opened DATE ENCODE AZ64, active BOOLEAN, source_file VARCHAR(1024), load_id CHAR(32), loaded_at TIMESTAMP, file_date DATE) DISTSTYLE KEY DISTKEY(account) INTERLEAVED SORTKEY(opened, loaded_at);
+CREATE TEMP TABLE accounts_staging( account VARCHAR(10), opened VARCHAR(8), active VARCHAR(1));
+COPY accounts_staging FROM 's3://testDB/accounts_2015-06-28.txt' IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy-test-us-west-2' FIXEDWIDTH 'account:10, opened:8, active:1';
+SELECT pg_last_copy_count();
+INSERT INTO raw_vendor_x.accounts (account, opened, active, source_file, load_id, loaded_at, file_date) SELECT UPPER(TRIM(account)), TO_DATE(NULLIF(TRIM(opened), ''), 'YYYYMMDD'), CASE UPPER(TRIM(active)) WHEN 'Y' THEN TRUE WHEN 'N' THEN FALSE END, 'accounts_2015-06-28.txt', '0123456789abcdef0123456789abcdef', '2018-11-15 10:30:00.000000'::TIMESTAMP, '2015-06-28'::DATE FROM accounts_staging;
+DROP TABLE accounts_staging;
+COMMIT
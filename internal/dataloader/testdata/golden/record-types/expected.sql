@@ -0,0 +1,10 @@
+BEGIN
+SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), CURRENT_SCHEMA()) AND TABLE_NAME = $2 ORDER BY ORDINAL_POSITION; -- $1 = "" -- $2 = "orders"
+CREATE TABLE orders( type VARCHAR(2), order_id VARCHAR(4)) DISTSTYLE KEY DISTKEY(order_id);
+SELECT TABLE_SCHEMA, COLUMN_NAME, DATA_TYPE, CHARACTER_MAXIMUM_LENGTH, NUMERIC_PRECISION, NUMERIC_SCALE, IS_NULLABLE FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), CURRENT_SCHEMA()) AND TABLE_NAME = $2 ORDER BY ORDINAL_POSITION; -- $1 = "" -- $2 = "order_lines"
+CREATE TABLE order_lines( type VARCHAR(2), order_id VARCHAR(4), sku VARCHAR(1)) COMPOUND SORTKEY(order_id, sku);
+COPY orders FROM 's3://testDB/staging/orders/orders_2015-06-28.txt' IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy-test-us-west-2' FIXEDWIDTH 'type:2, order_id:4';
+SELECT pg_last_copy_count();
+COPY order_lines FROM 's3://testDB/staging/order_lines/orders_2015-06-28.txt' IAM_ROLE 'arn:aws:iam::653026974230:role/data-loader-redshift-copy-test-us-west-2' FIXEDWIDTH 'type:2, order_id:4, sku:1';
+SELECT pg_last_copy_count();
+COMMIT
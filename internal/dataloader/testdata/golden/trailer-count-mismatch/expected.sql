@@ -0,0 +1 @@
+-- error: trailer record: record count mismatch: control record says 3 rows, file has 1
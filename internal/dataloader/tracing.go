@@ -0,0 +1,43 @@
+package dataloader
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name the loader's spans are reported under when DataLoader.Tracer isn't set.
+const instrumentationName = "github.com/ellery44/data-loader/internal/dataloader"
+
+// Attribute keys of load spans.
+const (
+	attrKey        = attribute.Key("data_loader.key")
+	attrTarget     = attribute.Key("data_loader.target")
+	attrTable      = attribute.Key("data_loader.table")
+	attrCopyKey    = attribute.Key("data_loader.copy_key")
+	attrLoadID     = attribute.Key("data_loader.load_id")
+	attrRows       = attribute.Key("data_loader.rows")
+	attrErrorClass = attribute.Key("data_loader.error_class")
+)
+
+// Starts a span of a load phase as a child of any span in ctx.
+func (d *DataLoader) startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := d.Tracer
+	if tracer == nil {
+		tracer = otel.Tracer(instrumentationName)
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Ends span, marking it failed with err and its class when err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(attrErrorClass.String(ErrorClass(err)))
+	}
+	span.End()
+}
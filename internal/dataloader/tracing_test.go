@@ -0,0 +1,114 @@
+package dataloader
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer keeps every span it starts, in start order.
+type recordingTracer struct {
+	noop.Tracer
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	config := trace.NewSpanStartConfig(opts...)
+	span := &recordedSpan{name: name, attributes: make(map[attribute.Key]interface{})}
+	span.SetAttributes(config.Attributes()...)
+	t.spans = append(t.spans, span)
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type recordedSpan struct {
+	noop.Span
+	name       string
+	attributes map[attribute.Key]interface{}
+	status     codes.Code
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attributes[attr.Key] = attr.Value.AsInterface()
+	}
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, description string) {
+	s.status = code
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+func TestLoadSpans(t *testing.T) {
+	tests := []struct {
+		name   string
+		copied int64
+		spans  []string
+		failed []string
+	}{
+		{
+			name:   "loaded",
+			copied: 1,
+			spans:  []string{"LoadDataFile", "FetchSchema", "Prepare", "CheckTable", "CreateTable", "Copy"},
+		},
+		{
+			name:   "copy-fails",
+			copied: 0,
+			spans:  []string{"LoadDataFile", "FetchSchema", "Prepare", "CheckTable", "CreateTable", "Copy"},
+			failed: []string{"LoadDataFile", "Copy"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			s3Svc := newFakeS3("testSchemas", map[string]string{"testformat1.csv": "name,width,datatype\nname,10,TEXT\n"})
+			s3Svc.Put("testDB", "testformat1_2015-06-28.txt", "Foonyor   \n")
+			svc := &DataLoader{
+				DB:           &recordingExecutor{rows: map[string][][]interface{}{"SELECT pg_last_copy_count();": {{tt.copied}}}},
+				Logger:       log.NewNopLogger(),
+				DataBucket:   "testDB",
+				SchemaBucket: "testSchemas",
+				S3Svc:        s3Svc,
+				Tracer:       tracer,
+				loadID:       func() string { return "0123456789abcdef0123456789abcdef" },
+			}
+			svc.LoadDataFileToRedshift(context.Background(), "testformat1_2015-06-28.txt")
+
+			var names, failed []string
+			for _, span := range tracer.spans {
+				names = append(names, span.name)
+				if span.status == codes.Error {
+					failed = append(failed, span.name)
+				}
+				if !span.ended {
+					t.Errorf("span %s was not ended", span.name)
+				}
+			}
+			if !reflect.DeepEqual(tt.spans, names) {
+				t.Errorf("want: %q, got: %q", tt.spans, names)
+			}
+			if !reflect.DeepEqual(tt.failed, failed) {
+				t.Errorf("want failed: %q, got: %q", tt.failed, failed)
+			}
+
+			load, copySpan := tracer.spans[0], tracer.spans[len(tracer.spans)-1]
+			if load.attributes[attrKey] != "testformat1_2015-06-28.txt" || load.attributes[attrTarget] != "testformat1" ||
+				load.attributes[attrLoadID] != "0123456789abcdef0123456789abcdef" {
+				t.Errorf("unexpected load span attributes: %v", load.attributes)
+			}
+			if copySpan.attributes[attrTable] != "testformat1" || copySpan.attributes[attrCopyKey] != "testformat1_2015-06-28.txt" ||
+				copySpan.attributes[attrRows] != tt.copied {
+				t.Errorf("unexpected copy span attributes: %v", copySpan.attributes)
+			}
+		})
+	}
+}
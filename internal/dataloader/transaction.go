@@ -0,0 +1,38 @@
+package dataloader
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// loadStep is one step of loading a file. All the steps of a load run in the same transaction, so a load either
+// leaves behind everything its steps did or nothing at all.
+type loadStep func(ctx context.Context, tx Tx) error
+
+// Runs steps in order inside one transaction, committing once all of them succeed. Any failing step, or ctx being
+// cancelled between steps, rolls the whole transaction back.
+func (d *DataLoader) runInTransaction(ctx context.Context, steps ...loadStep) (err error) {
+	tx, err := d.DB.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil && rollbackErr != sql.ErrTxDone {
+			level.Warn(d.Logger).Log("msg", "failed to roll back load transaction", "err", rollbackErr)
+		}
+	}()
+	for _, step := range steps {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = step(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,79 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestRunInTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		cancel     bool
+		err        error
+		statements []string
+	}{
+		{name: "happy-path", statements: []string{"BEGIN", "CREATE TABLE t( a INTEGER);", "COPY t", "COMMIT"}},
+		{name: "step-fails", err: errors.New("copy failed"), statements: []string{"BEGIN", "CREATE TABLE t( a INTEGER);", "ROLLBACK"}},
+		{name: "cancelled", cancel: true, err: context.Canceled, statements: []string{"BEGIN", "CREATE TABLE t( a INTEGER);", "ROLLBACK"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &recordingExecutor{}
+			svc := &DataLoader{DB: db, Logger: log.NewNopLogger()}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			err := svc.runInTransaction(ctx,
+				func(ctx context.Context, tx Tx) error {
+					_, err := tx.ExecContext(ctx, "CREATE TABLE t( a INTEGER);")
+					if tt.cancel {
+						cancel()
+					}
+					return err
+				},
+				func(ctx context.Context, tx Tx) error {
+					if tt.err != nil && !tt.cancel {
+						return tt.err
+					}
+					_, err := tx.ExecContext(ctx, "COPY t")
+					return err
+				},
+			)
+			if err != tt.err && (err == nil || tt.err == nil || err.Error() != tt.err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			assertStatements(t, tt.statements, db.statements)
+		})
+	}
+}
+
+func TestCreateTablesStep(t *testing.T) {
+	db := &recordingExecutor{}
+	svc := &DataLoader{DB: db, Logger: log.NewNopLogger()}
+	schema := &tableSchema{
+		TargetSchema: "raw_vendor_x",
+		Columns:      []dBColumnSchema{{Width: "10", Name: "name", DataType: "TEXT"}},
+	}
+
+	copyErr := errors.New("copy failed")
+	err := svc.runInTransaction(context.Background(),
+		svc.createTablesStep(schema, "testformat1", &LoadResult{}),
+		func(ctx context.Context, tx Tx) error { return copyErr },
+	)
+	if err != copyErr {
+		t.Errorf("want: %v, got: %v", copyErr, err)
+	}
+
+	// Schema and table are created in the load's transaction, so a later failure leaves neither behind
+	want := []string{
+		"BEGIN",
+		"CREATE SCHEMA IF NOT EXISTS raw_vendor_x;",
+		"SELECT TABLE_SCHEMA",
+		"CREATE TABLE raw_vendor_x.testformat1( name VARCHAR(10));",
+		"ROLLBACK",
+	}
+	assertStatements(t, want, db.statements)
+}
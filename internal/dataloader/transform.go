@@ -0,0 +1,149 @@
+package dataloader
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// columnTransform is a clean-up a schema can declare for a column, applied in SQL between the staging COPY and the
+// insert into the real table.
+type columnTransform struct {
+	// Type of value the transform works on and the type it produces.
+	input, output string
+	// Whether the transform needs an argument after a ':'.
+	hasArg bool
+	// Argument values allowed, which end up inside the generated SQL.
+	validArg *regexp.Regexp
+	// Wraps expr in the SQL applying the transform.
+	render func(expr, arg string) string
+}
+
+var (
+	// Redshift datetime format strings. https://docs.aws.amazon.com/redshift/latest/dg/r_FORMAT_strings.html
+	dateFormatArg = regexp.MustCompile(`^[A-Za-z0-9 /.:-]+$`)
+	// Pair of true/false values, e.g. Y/N.
+	booleanArg = regexp.MustCompile(`^[A-Za-z0-9]+/[A-Za-z0-9]+$`)
+)
+
+var columnTransforms = map[string]columnTransform{
+	"trim": {
+		input:  "TEXT",
+		output: "TEXT",
+		render: func(expr, _ string) string { return fmt.Sprintf("TRIM(%s)", expr) },
+	},
+	"upper": {
+		input:  "TEXT",
+		output: "TEXT",
+		render: func(expr, _ string) string { return fmt.Sprintf("UPPER(%s)", expr) },
+	},
+	"lower": {
+		input:  "TEXT",
+		output: "TEXT",
+		render: func(expr, _ string) string { return fmt.Sprintf("LOWER(%s)", expr) },
+	},
+	// date:YYYYMMDD parses the text with the passed format, blanks become NULL.
+	"date": {
+		input:    "TEXT",
+		output:   "DATE",
+		hasArg:   true,
+		validArg: dateFormatArg,
+		render: func(expr, arg string) string {
+			return fmt.Sprintf("TO_DATE(NULLIF(TRIM(%s), ''), %s)", expr, quoteLiteral(arg))
+		},
+	},
+	// boolean:Y/N maps the first value to TRUE and the second to FALSE, anything else becomes NULL.
+	"boolean": {
+		input:    "TEXT",
+		output:   "BOOLEAN",
+		hasArg:   true,
+		validArg: booleanArg,
+		render: func(expr, arg string) string {
+			values := strings.SplitN(arg, "/", 2)
+			return fmt.Sprintf("CASE UPPER(TRIM(%s)) WHEN %s THEN TRUE WHEN %s THEN FALSE END",
+				expr, quoteLiteral(strings.ToUpper(values[0])), quoteLiteral(strings.ToUpper(values[1])))
+		},
+	},
+}
+
+// Splits a declared transform into its name and argument.
+func parseTransform(declared string) (columnTransform, string, error) {
+	name, arg := declared, ""
+	if i := strings.Index(declared, ":"); i >= 0 {
+		name, arg = declared[:i], declared[i+1:]
+	}
+	t, ok := columnTransforms[name]
+	if !ok {
+		return columnTransform{}, "", fmt.Errorf("unknown transform %s", name)
+	}
+	if t.hasArg != (arg != "") {
+		if t.hasArg {
+			return columnTransform{}, "", fmt.Errorf("transform %s needs an argument", name)
+		}
+		return columnTransform{}, "", fmt.Errorf("transform %s takes no argument", name)
+	}
+	if t.hasArg && !t.validArg.MatchString(arg) {
+		return columnTransform{}, "", fmt.Errorf("invalid argument %q for transform %s", arg, name)
+	}
+	return t, arg, nil
+}
+
+// Checks the transforms declared for col exist and chain together, returning the type of the transformed value.
+func validateTransforms(col dBColumnSchema) (string, error) {
+	valueType := col.DataType
+	for _, declared := range col.Transforms {
+		t, _, err := parseTransform(declared)
+		if err != nil {
+			return "", fmt.Errorf("column %s: %v", col.Name, err)
+		}
+		if t.input != valueType {
+			return "", fmt.Errorf("column %s: transform %s needs a %s value, got %s", col.Name, declared, t.input, valueType)
+		}
+		valueType = t.output
+	}
+	return valueType, nil
+}
+
+// Renders the SQL expression selecting col out of the staging table with its transforms applied.
+func transformExpression(col dBColumnSchema) string {
+	expr := col.Name
+	for _, declared := range col.Transforms {
+		t, arg, err := parseTransform(declared)
+		if err != nil {
+			// Transforms are validated when the schema is loaded
+			continue
+		}
+		expr = t.render(expr, arg)
+	}
+	return expr
+}
+
+// Returns the redshift type col has in the real table when its transforms change the type, or "" if they don't.
+func transformedDataType(col dBColumnSchema) string {
+	valueType, err := validateTransforms(col)
+	if err != nil || valueType == col.DataType {
+		return ""
+	}
+	return valueType
+}
+
+// Strips transforms and encodings from columns, giving the layout of the staging table COPY loads raw values into.
+func rawColumns(columns []dBColumnSchema) []dBColumnSchema {
+	raw := make([]dBColumnSchema, 0, len(columns))
+	for _, col := range columns {
+		col.Transforms = nil
+		col.Encode = ""
+		raw = append(raw, col)
+	}
+	return raw
+}
+
+// Reports if any of columns declares transforms.
+func hasTransforms(columns []dBColumnSchema) bool {
+	for _, col := range columns {
+		if len(col.Transforms) != 0 {
+			return true
+		}
+	}
+	return false
+}
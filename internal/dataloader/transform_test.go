@@ -0,0 +1,103 @@
+package dataloader
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestValidateTransforms(t *testing.T) {
+	tests := []struct {
+		name string
+		col  dBColumnSchema
+		want string
+		err  error
+	}{
+		{name: "none", col: dBColumnSchema{Name: "a", DataType: "INTEGER"}, want: "INTEGER"},
+		{name: "text", col: dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"trim", "upper"}}, want: "TEXT"},
+		{name: "date", col: dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"date:YYYY-MM-DD"}}, want: "DATE"},
+		{name: "boolean", col: dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"boolean:Y/N"}}, want: "BOOLEAN"},
+		{
+			name: "unknown",
+			col:  dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"reverse"}},
+			err:  errors.New("column a: unknown transform reverse"),
+		},
+		{
+			name: "missing-argument",
+			col:  dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"date"}},
+			err:  errors.New("column a: transform date needs an argument"),
+		},
+		{
+			name: "unexpected-argument",
+			col:  dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"trim:both"}},
+			err:  errors.New("column a: transform trim takes no argument"),
+		},
+		{
+			name: "invalid-argument",
+			col:  dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"date:YYYY'MM"}},
+			err:  errors.New(`column a: invalid argument "YYYY'MM" for transform date`),
+		},
+		{
+			name: "wrong-type",
+			col:  dBColumnSchema{Name: "a", DataType: "INTEGER", Transforms: []string{"trim"}},
+			err:  errors.New("column a: transform trim needs a TEXT value, got INTEGER"),
+		},
+		{
+			name: "chained-after-date",
+			col:  dBColumnSchema{Name: "a", DataType: "TEXT", Transforms: []string{"date:YYYYMMDD", "upper"}},
+			err:  errors.New("column a: transform upper needs a TEXT value, got DATE"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateTransforms(tt.col)
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if got != tt.want {
+				t.Errorf("want: %s, got: %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBuildTransformQueries(t *testing.T) {
+	svc := &DataLoader{DataBucket: "testDB", Logger: log.NewNopLogger()}
+	columns := []dBColumnSchema{
+		{Width: "10", Name: "name", DataType: "TEXT", Transforms: []string{"trim", "upper"}},
+		{Width: "8", Name: "opened", DataType: "TEXT", Transforms: []string{"date:YYYYMMDD"}},
+		{Width: "1", Name: "active", DataType: "TEXT", Transforms: []string{"boolean:y/n"}},
+		{Width: "3", Name: "count", DataType: "INTEGER"},
+	}
+
+	got, err := svc.buildCreateTableQuery(tableLayout{Table: "testtable", Columns: columns})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "CREATE TABLE testtable( name VARCHAR(10), opened DATE, active BOOLEAN, count INTEGER);"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	got, err = svc.buildCreateStagingTableQuery("testtable_staging", columns, encodingUTF8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = "CREATE TEMP TABLE testtable_staging( name VARCHAR(10), opened VARCHAR(8), active VARCHAR(1), count INTEGER);"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	target := copyTarget{Table: "testtable", Columns: columns}
+	if !target.viaStagingTable() {
+		t.Errorf("want target with transforms to load via a staging table")
+	}
+	got = svc.buildInsertFromStagingQuery(&sourceFile{}, target)
+	want = "INSERT INTO testtable (name, opened, active, count) SELECT UPPER(TRIM(name)), " +
+		"TO_DATE(NULLIF(TRIM(opened), ''), 'YYYYMMDD'), " +
+		"CASE UPPER(TRIM(active)) WHEN 'Y' THEN TRUE WHEN 'N' THEN FALSE END, count FROM testtable_staging;"
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
@@ -0,0 +1,149 @@
+package dbconn
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// How long before they expire cached credentials are replaced when no RefreshWindow is set.
+const defaultRefreshWindow = time.Minute
+
+// Postgres error codes redshift rejects a login with.
+// https://www.postgresql.org/docs/8.0/errcodes-appendix.html
+const (
+	invalidAuthorizationSpecification = "28000"
+	invalidPassword                   = "28P01"
+)
+
+// Connector is a driver.Connector for redshift that logs every new connection in with the current credentials of its
+// provider. Credentials are cached until shortly before they expire or until the database rejects them, connections
+// already open are unaffected either way. Use it with sql.OpenDB.
+type Connector struct {
+	Host     string
+	Port     int
+	DBName   string
+	Provider CredentialProvider
+	// Looks up the host when neither Host nor the credentials have one, e.g. the cluster endpoint kept in SSM for
+	// secrets without a host. The host is looked up again whenever credentials are fetched.
+	LookupHost func(ctx context.Context) (string, error)
+	// How long before their expiry cached credentials are refreshed.
+	RefreshWindow time.Duration
+
+	mu     sync.Mutex
+	cached *Credentials
+	now    func() time.Time
+	open   func(dsn string) (driver.Conn, error)
+}
+
+// Connect implements driver.Connector.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	creds, err := c.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if c.Host == "" && creds.Host == "" {
+		// lib/pq would quietly connect to localhost instead
+		return nil, errors.New("no database host, neither the connector nor its credentials have one")
+	}
+	conn, err := c.openConn(c.dataSourceName(creds))
+	if !isAuthFailure(err) {
+		return conn, err
+	}
+
+	// The cached credentials may have been rotated since they were fetched, try once more with fresh ones
+	c.invalidate(creds)
+	if creds, err = c.credentials(ctx); err != nil {
+		return nil, err
+	}
+	return c.openConn(c.dataSourceName(creds))
+}
+
+// Driver implements driver.Connector.
+func (c *Connector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+func (c *Connector) openConn(dsn string) (driver.Conn, error) {
+	if c.open != nil {
+		return c.open(dsn)
+	}
+	return c.Driver().Open(dsn)
+}
+
+// Returns the cached credentials, fetching new ones from the provider if there are none or they are about to expire.
+func (c *Connector) credentials(ctx context.Context) (Credentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	window := c.RefreshWindow
+	if window == 0 {
+		window = defaultRefreshWindow
+	}
+	if c.cached != nil && (c.cached.Expires.IsZero() || now().Add(window).Before(c.cached.Expires)) {
+		return *c.cached, nil
+	}
+	creds, err := c.Provider.Credentials(ctx)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("fetching database credentials: %v", err)
+	}
+	if c.Host == "" && creds.Host == "" && c.LookupHost != nil {
+		if creds.Host, err = c.LookupHost(ctx); err != nil {
+			return Credentials{}, fmt.Errorf("looking up database host: %v", err)
+		}
+	}
+	c.cached = &creds
+	return creds, nil
+}
+
+// Drops creds from the cache, unless another connection already replaced them.
+func (c *Connector) invalidate(creds Credentials) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cached != nil && *c.cached == creds {
+		c.cached = nil
+	}
+}
+
+// Reports if err is the database refusing a login.
+func isAuthFailure(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && (pqErr.Code == invalidPassword || pqErr.Code == invalidAuthorizationSpecification)
+}
+
+// Builds the lib/pq connection string for passed credentials, which take precedence over the connector's endpoint.
+func (c *Connector) dataSourceName(creds Credentials) string {
+	host, port, dbName := c.Host, c.Port, c.DBName
+	if creds.Host != "" {
+		host = creds.Host
+	}
+	if creds.Port != 0 {
+		port = creds.Port
+	}
+	if creds.DBName != "" {
+		dbName = creds.DBName
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
+		quoteValue(host),
+		port,
+		quoteValue(creds.User),
+		quoteValue(creds.Password),
+		quoteValue(dbName))
+}
+
+// Quotes a connection string value so spaces, quotes and backslashes, common in generated passwords, survive.
+func quoteValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `'`, `\'`, -1)
+	return "'" + v + "'"
+}
@@ -0,0 +1,191 @@
+package dbconn
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type countingProvider struct {
+	creds []Credentials
+	err   error
+	calls int
+}
+
+func (p *countingProvider) Credentials(ctx context.Context) (Credentials, error) {
+	if p.err != nil {
+		return Credentials{}, p.err
+	}
+	creds := p.creds[p.calls]
+	p.calls++
+	return creds, nil
+}
+
+func TestConnectorCredentials(t *testing.T) {
+	start := time.Date(2018, 11, 15, 10, 0, 0, 0, time.UTC)
+	provider := &countingProvider{creds: []Credentials{
+		{User: "IAM:loader", Password: "first", Expires: start.Add(15 * time.Minute)},
+		{User: "IAM:loader", Password: "second", Expires: start.Add(30 * time.Minute)},
+	}}
+	now := start
+	c := &Connector{Provider: provider, now: func() time.Time { return now }}
+
+	tests := []struct {
+		name     string
+		at       time.Duration
+		password string
+		calls    int
+	}{
+		{name: "first-fetch", at: 0, password: "first", calls: 1},
+		{name: "cached", at: 10 * time.Minute, password: "first", calls: 1},
+		{name: "refreshed-before-expiry", at: 14*time.Minute + 30*time.Second, password: "second", calls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = start.Add(tt.at)
+			got, err := c.credentials(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Password != tt.password {
+				t.Errorf("want: %s, got: %s", tt.password, got.Password)
+			}
+			if provider.calls != tt.calls {
+				t.Errorf("want %d provider calls, got %d", tt.calls, provider.calls)
+			}
+		})
+	}
+}
+
+func TestConnectorCredentialsNeverExpiring(t *testing.T) {
+	provider := &countingProvider{creds: []Credentials{{User: "admin", Password: "secret"}}}
+	c := &Connector{Provider: provider}
+	for i := 0; i < 3; i++ {
+		if _, err := c.credentials(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("want 1 provider call, got %d", provider.calls)
+	}
+}
+
+func TestConnectorCredentialsError(t *testing.T) {
+	c := &Connector{Provider: &countingProvider{err: errors.New("access denied")}}
+	_, err := c.credentials(context.Background())
+	if want := "fetching database credentials: access denied"; err == nil || err.Error() != want {
+		t.Errorf("want: %s, got: %v", want, err)
+	}
+}
+
+func TestDataSourceName(t *testing.T) {
+	c := &Connector{Host: "cluster.example.com", Port: 5439, DBName: "data-loader-dev"}
+	got := c.dataSourceName(Credentials{User: "IAM:loader", Password: `p a'ss\word`})
+	want := `host='cluster.example.com' port=5439 user='IAM:loader' password='p a\'ss\\word' dbname='data-loader-dev'`
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+
+	// Endpoints from the credential source win
+	got = c.dataSourceName(Credentials{User: "loader", Password: "pw", Host: "localhost", Port: 5432, DBName: "dev"})
+	want = `host='localhost' port=5432 user='loader' password='pw' dbname='dev'`
+	if want != got {
+		t.Errorf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestConnectRefreshesRejectedCredentials(t *testing.T) {
+	provider := &countingProvider{creds: []Credentials{
+		{User: "loader", Password: "rotated-away"},
+		{User: "loader", Password: "current"},
+	}}
+	var passwords []string
+	c := &Connector{
+		Host:     "cluster.example.com",
+		Port:     5439,
+		DBName:   "data-loader-dev",
+		Provider: provider,
+		open: func(dsn string) (driver.Conn, error) {
+			passwords = append(passwords, dsn)
+			if strings.Contains(dsn, "rotated-away") {
+				return nil, &pq.Error{Code: invalidPassword, Message: "password authentication failed"}
+			}
+			return nil, nil
+		},
+	}
+	if _, err := c.Connect(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(passwords) != 2 || !strings.Contains(passwords[1], "password='current'") {
+		t.Errorf("want a second login with current credentials, got: %v", passwords)
+	}
+
+	// Other failures are returned as they are, without refetching credentials
+	c.open = func(dsn string) (driver.Conn, error) { return nil, errors.New("connection refused") }
+	if _, err := c.Connect(context.Background()); err == nil || err.Error() != "connection refused" {
+		t.Errorf("want: connection refused, got: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("want 2 provider calls, got %d", provider.calls)
+	}
+}
+
+func TestConnectLooksUpMissingHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		creds   Credentials
+		lookup  bool
+		dsnHost string
+		lookups int
+		err     string
+	}{
+		{name: "credentials-host", creds: Credentials{User: "loader", Password: "pw", Host: "secret.example.com"},
+			lookup: true, dsnHost: "host='secret.example.com'"},
+		{name: "looked-up-host", creds: Credentials{User: "loader", Password: "pw"},
+			lookup: true, dsnHost: "host='cluster.example.com'", lookups: 1},
+		{name: "no-host", creds: Credentials{User: "loader", Password: "pw"},
+			err: "no database host, neither the connector nor its credentials have one"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dsns []string
+			lookups := 0
+			c := &Connector{
+				Port:     5439,
+				DBName:   "data-loader-dev",
+				Provider: StaticCredentials(tt.creds),
+				open: func(dsn string) (driver.Conn, error) {
+					dsns = append(dsns, dsn)
+					return nil, nil
+				},
+			}
+			if tt.lookup {
+				c.LookupHost = func(ctx context.Context) (string, error) {
+					lookups++
+					return "cluster.example.com", nil
+				}
+			}
+
+			// The looked up host is cached with the credentials
+			for i := 0; i < 2; i++ {
+				_, err := c.Connect(context.Background())
+				if (tt.err == "") != (err == nil) || (err != nil && err.Error() != tt.err) {
+					t.Fatalf("want: %s, got: %v", tt.err, err)
+				}
+			}
+			for _, dsn := range dsns {
+				if !strings.Contains(dsn, tt.dsnHost) {
+					t.Errorf("want %s, got: %s", tt.dsnHost, dsn)
+				}
+			}
+			if lookups != tt.lookups {
+				t.Errorf("want %d host lookups, got %d", tt.lookups, lookups)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Package dbconn opens the loader's connections to redshift, logging each one in with credentials that may change
+// while the process runs.
+package dbconn
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Credentials a connection logs in to the database with.
+type Credentials struct {
+	User     string
+	Password string
+	// When the credentials stop working, zero if they never expire.
+	Expires time.Time
+
+	// Where to connect, for providers whose source also holds the endpoint. Zero values leave it to the Connector.
+	Host   string
+	Port   int
+	DBName string
+}
+
+// CredentialProvider fetches the credentials new connections log in with. Credentials are fetched again when they
+// are about to expire or the database rejects them, e.g. after a rotation.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// StaticCredentials always returns the same, non-expiring credentials.
+type StaticCredentials Credentials
+
+// Credentials implements CredentialProvider.
+func (c StaticCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	return Credentials(c), nil
+}
+
+// redshiftSecret is the JSON shape of the secrets Secrets Manager keeps for redshift clusters, which the file provider
+// reads too.
+// https://docs.aws.amazon.com/secretsmanager/latest/userguide/reference_secret_json_structure.html
+type redshiftSecret struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	DBName   string `json:"dbname"`
+}
+
+// Parses credentials out of a redshift secret.
+func parseRedshiftSecret(raw []byte) (Credentials, error) {
+	var secret redshiftSecret
+	if err := json.Unmarshal(raw, &secret); err != nil {
+		return Credentials{}, fmt.Errorf("invalid redshift secret: %v", err)
+	}
+	if secret.Username == "" || secret.Password == "" {
+		return Credentials{}, fmt.Errorf("redshift secret has no username or password")
+	}
+	return Credentials{
+		User:     secret.Username,
+		Password: secret.Password,
+		Host:     secret.Host,
+		Port:     secret.Port,
+		DBName:   secret.DBName,
+	}, nil
+}
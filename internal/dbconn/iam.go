@@ -0,0 +1,58 @@
+package dbconn
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/redshift"
+	"github.com/aws/aws-sdk-go/service/redshift/redshiftiface"
+)
+
+// Redshift's default lifetime of credentials from GetClusterCredentials.
+// https://docs.aws.amazon.com/redshift/latest/APIReference/API_GetClusterCredentials.html
+const defaultClusterCredentialsDuration = 15 * time.Minute
+
+// ClusterCredentials gets temporary credentials for a database user of a provisioned cluster through IAM with
+// redshift GetClusterCredentials, so the loader never needs a database password.
+type ClusterCredentials struct {
+	Svc               redshiftiface.RedshiftAPI
+	ClusterIdentifier string
+	DBUser            string
+	DBName            string
+	// Create DBUser on its first login, joined to DBGroups for the session.
+	AutoCreate bool
+	DBGroups   []string
+	// How long the credentials last, between 15 minutes and an hour. Redshift's default when zero.
+	Duration time.Duration
+}
+
+// Credentials implements CredentialProvider.
+func (c *ClusterCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	input := &redshift.GetClusterCredentialsInput{
+		ClusterIdentifier: aws.String(c.ClusterIdentifier),
+		DbUser:            aws.String(c.DBUser),
+		AutoCreate:        aws.Bool(c.AutoCreate),
+	}
+	if c.DBName != "" {
+		input.DbName = aws.String(c.DBName)
+	}
+	if len(c.DBGroups) != 0 {
+		input.DbGroups = aws.StringSlice(c.DBGroups)
+	}
+	duration := c.Duration
+	if duration == 0 {
+		duration = defaultClusterCredentialsDuration
+	}
+	input.DurationSeconds = aws.Int64(int64(duration / time.Second))
+
+	rsp, err := c.Svc.GetClusterCredentialsWithContext(ctx, input)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{
+		User:     aws.StringValue(rsp.DbUser),
+		Password: aws.StringValue(rsp.DbPassword),
+		Expires:  aws.TimeValue(rsp.Expiration),
+	}, nil
+}
@@ -0,0 +1,69 @@
+package dbconn
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/redshift"
+	"github.com/aws/aws-sdk-go/service/redshift/redshiftiface"
+)
+
+type mockRedshift struct {
+	redshiftiface.RedshiftAPI
+	input       *redshift.GetClusterCredentialsInput
+	errToReturn error
+}
+
+func (m *mockRedshift) GetClusterCredentialsWithContext(ctx aws.Context, input *redshift.GetClusterCredentialsInput, opts ...request.Option) (*redshift.GetClusterCredentialsOutput, error) {
+	m.input = input
+	if m.errToReturn != nil {
+		return nil, m.errToReturn
+	}
+	return &redshift.GetClusterCredentialsOutput{
+		DbUser:     aws.String("IAM:" + aws.StringValue(input.DbUser)),
+		DbPassword: aws.String("temporary"),
+		Expiration: aws.Time(time.Date(2018, 11, 15, 10, 15, 0, 0, time.UTC)),
+	}, nil
+}
+
+func TestClusterCredentials(t *testing.T) {
+	svc := &mockRedshift{}
+	c := &ClusterCredentials{
+		Svc:               svc,
+		ClusterIdentifier: "data-loader-dev",
+		DBUser:            "data_loader",
+		DBName:            "data-loader-dev",
+		AutoCreate:        true,
+		DBGroups:          []string{"loaders"},
+		Duration:          time.Hour,
+	}
+	got, err := c.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Credentials{User: "IAM:data_loader", Password: "temporary", Expires: time.Date(2018, 11, 15, 10, 15, 0, 0, time.UTC)}
+	if want != got {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+	wantInput := &redshift.GetClusterCredentialsInput{
+		ClusterIdentifier: aws.String("data-loader-dev"),
+		DbUser:            aws.String("data_loader"),
+		DbName:            aws.String("data-loader-dev"),
+		AutoCreate:        aws.Bool(true),
+		DbGroups:          aws.StringSlice([]string{"loaders"}),
+		DurationSeconds:   aws.Int64(3600),
+	}
+	if !reflect.DeepEqual(wantInput, svc.input) {
+		t.Errorf("want: %+v, got: %+v", wantInput, svc.input)
+	}
+
+	svc.errToReturn = errors.New("not authorized")
+	if _, err := c.Credentials(context.Background()); err == nil || err.Error() != "not authorized" {
+		t.Errorf("want: not authorized, got: %v", err)
+	}
+}
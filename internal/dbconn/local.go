@@ -0,0 +1,57 @@
+package dbconn
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+// Environment variables EnvCredentials reads.
+const (
+	envUser     = "DB_USER"
+	envPassword = "DB_PASSWORD"
+	envHost     = "DB_HOST"
+	envPort     = "DB_PORT"
+	envName     = "DB_NAME"
+)
+
+// EnvCredentials reads credentials, and optionally the endpoint, from DB_USER, DB_PASSWORD, DB_HOST, DB_PORT and
+// DB_NAME. Meant for local runs and CI.
+type EnvCredentials struct{}
+
+// Credentials implements CredentialProvider.
+func (EnvCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	creds := Credentials{
+		User:     os.Getenv(envUser),
+		Password: os.Getenv(envPassword),
+		Host:     os.Getenv(envHost),
+		DBName:   os.Getenv(envName),
+	}
+	if creds.User == "" {
+		return Credentials{}, fmt.Errorf("%s undefined", envUser)
+	}
+	if port := os.Getenv(envPort); port != "" {
+		var err error
+		if creds.Port, err = strconv.Atoi(port); err != nil {
+			return Credentials{}, fmt.Errorf("invalid %s %q", envPort, port)
+		}
+	}
+	return creds, nil
+}
+
+// FileCredentials reads credentials from a local file holding a redshift secret as JSON. The file is read whenever
+// credentials are fetched, so edits are picked up once the Connector's cached credentials are rejected.
+type FileCredentials struct {
+	Path string
+}
+
+// Credentials implements CredentialProvider.
+func (c *FileCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	raw, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return parseRedshiftSecret(raw)
+}
@@ -0,0 +1,68 @@
+package dbconn
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvCredentials(t *testing.T) {
+	for name, value := range map[string]string{
+		envUser: "loader", envPassword: "secret", envHost: "localhost", envPort: "5432", envName: "dev",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+	got, err := EnvCredentials{}.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Credentials{User: "loader", Password: "secret", Host: "localhost", Port: 5432, DBName: "dev"}
+	if want != got {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+
+	os.Setenv(envPort, "postgres")
+	if _, err := (EnvCredentials{}).Credentials(context.Background()); err == nil || err.Error() != `invalid DB_PORT "postgres"` {
+		t.Errorf("want invalid port error, got: %v", err)
+	}
+	os.Setenv(envUser, "")
+	if _, err := (EnvCredentials{}).Credentials(context.Background()); err == nil || err.Error() != "DB_USER undefined" {
+		t.Errorf("want undefined user error, got: %v", err)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbconn-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	c := &FileCredentials{Path: path}
+
+	// Re-read on every call so a rotated file is picked up
+	for _, password := range []string{"first", "second"} {
+		raw := `{"username": "loader", "password": "` + password + `", "host": "localhost", "port": 5432}`
+		if err := ioutil.WriteFile(path, []byte(raw), 0600); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Credentials(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := Credentials{User: "loader", Password: password, Host: "localhost", Port: 5432}
+		if want != got {
+			t.Errorf("want: %+v, got: %+v", want, got)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, []byte("username=loader"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Credentials(context.Background()); err == nil {
+		t.Errorf("want error for invalid file")
+	}
+}
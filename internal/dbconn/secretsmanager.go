@@ -0,0 +1,31 @@
+package dbconn
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// Version stage Secrets Manager rotation moves to the newest working version of a secret.
+const currentVersionStage = "AWSCURRENT"
+
+// SecretsManagerCredentials reads the current version of a redshift secret from Secrets Manager, including the
+// endpoint when the secret has one. Rotated secrets are picked up once the old password is rejected.
+type SecretsManagerCredentials struct {
+	Svc      secretsmanageriface.SecretsManagerAPI
+	SecretID string
+}
+
+// Credentials implements CredentialProvider.
+func (c *SecretsManagerCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	rsp, err := c.Svc.GetSecretValueWithContext(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(c.SecretID),
+		VersionStage: aws.String(currentVersionStage),
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	return parseRedshiftSecret([]byte(aws.StringValue(rsp.SecretString)))
+}
@@ -0,0 +1,65 @@
+package dbconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+}
+
+func (m *mockSecretsManager) GetSecretValueWithContext(ctx aws.Context, input *secretsmanager.GetSecretValueInput, opts ...request.Option) (*secretsmanager.GetSecretValueOutput, error) {
+	secret, ok := m.secrets[aws.StringValue(input.SecretId)]
+	if !ok || aws.StringValue(input.VersionStage) != currentVersionStage {
+		return nil, errors.New("ResourceNotFoundException")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+func TestSecretsManagerCredentials(t *testing.T) {
+	svc := &mockSecretsManager{secrets: map[string]string{
+		"data-loader/dev": `{"engine": "redshift", "username": "loader", "password": "secret",
+			"host": "cluster.example.com", "port": 5439, "dbname": "data-loader-dev", "dbClusterIdentifier": "data-loader-dev"}`,
+		"data-loader/broken": `{"username": "loader"}`,
+	}}
+	tests := []struct {
+		name     string
+		secretID string
+		want     Credentials
+		err      error
+	}{
+		{
+			name:     "happy-path",
+			secretID: "data-loader/dev",
+			want: Credentials{
+				User:     "loader",
+				Password: "secret",
+				Host:     "cluster.example.com",
+				Port:     5439,
+				DBName:   "data-loader-dev",
+			},
+		},
+		{name: "no-password", secretID: "data-loader/broken", err: errors.New("redshift secret has no username or password")},
+		{name: "missing", secretID: "data-loader/prod", err: errors.New("ResourceNotFoundException")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &SecretsManagerCredentials{Svc: svc, SecretID: tt.secretID}
+			got, err := c.Credentials(context.Background())
+			if (tt.err == nil) != (err == nil) || (err != nil && tt.err.Error() != err.Error()) {
+				t.Errorf("want: %v, got: %v", tt.err, err)
+			}
+			if tt.want != got {
+				t.Errorf("want: %+v, got: %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package dbconn
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+// SSMCredentials reads the database password from an encrypted SSM parameter.
+type SSMCredentials struct {
+	Svc               ssmiface.SSMAPI
+	User              string
+	PasswordParameter string
+}
+
+// Credentials implements CredentialProvider.
+func (c *SSMCredentials) Credentials(ctx context.Context) (Credentials, error) {
+	rsp, err := c.Svc.GetParameterWithContext(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(c.PasswordParameter),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{User: c.User, Password: aws.StringValue(rsp.Parameter.Value)}, nil
+}
@@ -0,0 +1,45 @@
+package dbconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+type mockSSM struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+}
+
+func (m *mockSSM) GetParameterWithContext(ctx aws.Context, input *ssm.GetParameterInput, opts ...request.Option) (*ssm.GetParameterOutput, error) {
+	value, ok := m.parameters[aws.StringValue(input.Name)]
+	if !ok || !aws.BoolValue(input.WithDecryption) {
+		return nil, errors.New("ParameterNotFound")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Name: input.Name, Value: aws.String(value)}}, nil
+}
+
+func TestSSMCredentials(t *testing.T) {
+	c := &SSMCredentials{
+		Svc:               &mockSSM{parameters: map[string]string{"/data-loader/dev/master-password": "secret"}},
+		User:              "admin",
+		PasswordParameter: "/data-loader/dev/master-password",
+	}
+	got, err := c.Credentials(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := (Credentials{User: "admin", Password: "secret"}); want != got {
+		t.Errorf("want: %+v, got: %+v", want, got)
+	}
+
+	c.PasswordParameter = "/data-loader/prod/master-password"
+	if _, err := c.Credentials(context.Background()); err == nil {
+		t.Errorf("want error for missing parameter")
+	}
+}
@@ -0,0 +1,312 @@
+// Package s3test provides an in-memory fake of the S3 API for tests, which can be seeded from a local directory such
+// as test-data/.
+package s3test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+)
+
+// ErrCodeNotFound is the error code HeadObject fails with for missing objects, S3 sending no body to HEAD requests.
+const ErrCodeNotFound = "NotFound"
+
+// Most keys ListObjectsV2 returns per page.
+const defaultMaxKeys = 1000
+
+// Fake is an in-memory s3iface.S3API. It serves GetObject, HeadObject, ListObjectsV2, PutObject, CopyObject and
+// DeleteObject, with and without context, and panics on other calls. Buckets spring into existence when first used,
+// reading a missing object fails with NoSuchKey whatever the bucket. Ranged GetObjects return the whole object.
+// The zero value is an empty store ready to use.
+type Fake struct {
+	s3iface.S3API
+
+	// Err, when set, fails every call instead of serving it.
+	Err error
+
+	mu      sync.Mutex
+	buckets map[string]map[string]object
+}
+
+type object struct {
+	body         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// Put stores body as the object at key in bucket, replacing any object there.
+func (f *Fake) Put(bucket, key, body string) {
+	f.put(bucket, key, []byte(body))
+}
+
+// Object returns the body of the object at key in bucket and whether there is one.
+func (f *Fake) Object(bucket, key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.buckets[bucket][key]
+	return string(obj.body), ok
+}
+
+// Keys returns the keys of all objects in bucket, sorted.
+func (f *Fake) Keys(bucket string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sortedKeys(bucket)
+}
+
+// LoadDir stores every file under dir as an object of bucket, keyed by its slash separated path relative to dir.
+func (f *Fake) LoadDir(bucket, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f.put(bucket, filepath.ToSlash(key), body)
+		return nil
+	})
+}
+
+// GetObject serves GetObjectWithContext without a context.
+func (f *Fake) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return f.GetObjectWithContext(context.Background(), input)
+}
+
+// GetObjectWithContext returns the body of the object.
+func (f *Fake) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	obj, err := f.get(ctx, aws.StringValue(input.Bucket), aws.StringValue(input.Key), s3.ErrCodeNoSuchKey)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{
+		Body:          ioutil.NopCloser(bytes.NewReader(obj.body)),
+		ContentLength: aws.Int64(int64(len(obj.body))),
+		ETag:          aws.String(obj.etag),
+		LastModified:  aws.Time(obj.lastModified),
+	}, nil
+}
+
+// HeadObject serves HeadObjectWithContext without a context.
+func (f *Fake) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return f.HeadObjectWithContext(context.Background(), input)
+}
+
+// HeadObjectWithContext returns the size, ETag and modification time of the object.
+func (f *Fake) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	obj, err := f.get(ctx, aws.StringValue(input.Bucket), aws.StringValue(input.Key), ErrCodeNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(obj.body))),
+		ETag:          aws.String(obj.etag),
+		LastModified:  aws.Time(obj.lastModified),
+	}, nil
+}
+
+// ListObjectsV2 serves ListObjectsV2WithContext without a context.
+func (f *Fake) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	return f.ListObjectsV2WithContext(context.Background(), input)
+}
+
+// ListObjectsV2WithContext lists the objects of the bucket in key order, honouring Prefix, Delimiter, StartAfter,
+// MaxKeys and the continuation token of a previous page.
+func (f *Fake) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var (
+		prefix    = aws.StringValue(input.Prefix)
+		delimiter = aws.StringValue(input.Delimiter)
+		start     = aws.StringValue(input.StartAfter)
+		maxKeys   = int64(defaultMaxKeys)
+		output    = &s3.ListObjectsV2Output{
+			Name:              input.Bucket,
+			Prefix:            input.Prefix,
+			ContinuationToken: input.ContinuationToken,
+			IsTruncated:       aws.Bool(false),
+		}
+	)
+	if input.ContinuationToken != nil {
+		start = *input.ContinuationToken
+	}
+	if input.MaxKeys != nil {
+		maxKeys = *input.MaxKeys
+	}
+	output.MaxKeys = aws.Int64(maxKeys)
+
+	var (
+		count        int64
+		lastKey      string
+		commonPrefix string
+	)
+	for _, key := range f.sortedKeys(aws.StringValue(input.Bucket)) {
+		if key <= start || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		// Keys under the common prefix just returned are rolled up into it
+		if commonPrefix != "" && strings.HasPrefix(key, commonPrefix) {
+			lastKey = key
+			continue
+		}
+		if count == maxKeys {
+			output.IsTruncated = aws.Bool(true)
+			output.NextContinuationToken = aws.String(lastKey)
+			break
+		}
+		count++
+		lastKey = key
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			commonPrefix = key[:len(prefix)+i+len(delimiter)]
+			output.CommonPrefixes = append(output.CommonPrefixes, &s3.CommonPrefix{Prefix: aws.String(commonPrefix)})
+			continue
+		}
+		obj := f.buckets[aws.StringValue(input.Bucket)][key]
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(int64(len(obj.body))),
+			ETag:         aws.String(obj.etag),
+			LastModified: aws.Time(obj.lastModified),
+		})
+	}
+	output.KeyCount = aws.Int64(count)
+	return output, nil
+}
+
+// PutObject serves PutObjectWithContext without a context.
+func (f *Fake) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return f.PutObjectWithContext(context.Background(), input)
+}
+
+// PutObjectWithContext stores the body read from input as the object.
+func (f *Fake) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	var body []byte
+	if input.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+	obj := f.put(aws.StringValue(input.Bucket), aws.StringValue(input.Key), body)
+	return &s3.PutObjectOutput{ETag: aws.String(obj.etag)}, nil
+}
+
+// CopyObject serves CopyObjectWithContext without a context.
+func (f *Fake) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	return f.CopyObjectWithContext(context.Background(), input)
+}
+
+// CopyObjectWithContext copies the object named by CopySource, a URL encoded "bucket/key", to the object.
+func (f *Fake) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	source, err := url.PathUnescape(strings.TrimPrefix(aws.StringValue(input.CopySource), "/"))
+	if err != nil {
+		return nil, awserr.New("InvalidArgument", "Invalid copy source encoding.", err)
+	}
+	parts := strings.SplitN(source, "/", 2)
+	if len(parts) != 2 {
+		return nil, awserr.New("InvalidArgument", "Copy Source must mention the source bucket and key: sourcebucket/sourcekey.", nil)
+	}
+	src, err := f.get(ctx, parts[0], parts[1], s3.ErrCodeNoSuchKey)
+	if err != nil {
+		return nil, err
+	}
+	obj := f.put(aws.StringValue(input.Bucket), aws.StringValue(input.Key), src.body)
+	return &s3.CopyObjectOutput{CopyObjectResult: &s3.CopyObjectResult{
+		ETag:         aws.String(obj.etag),
+		LastModified: aws.Time(obj.lastModified),
+	}}, nil
+}
+
+// DeleteObject serves DeleteObjectWithContext without a context.
+func (f *Fake) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return f.DeleteObjectWithContext(context.Background(), input)
+}
+
+// DeleteObjectWithContext removes the object. Like S3 it succeeds when there is none.
+func (f *Fake) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if err := f.check(ctx); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.buckets[aws.StringValue(input.Bucket)], aws.StringValue(input.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// Returns Err or, once ctx is done, the error the SDK fails cancelled requests with.
+func (f *Fake) check(ctx aws.Context) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return nil
+}
+
+func (f *Fake) get(ctx aws.Context, bucket, key, notFoundCode string) (object, error) {
+	if err := f.check(ctx); err != nil {
+		return object{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.buckets[bucket][key]
+	if !ok {
+		return object{}, awserr.New(notFoundCode, "The specified key does not exist.", nil)
+	}
+	return obj, nil
+}
+
+func (f *Fake) put(bucket, key string, body []byte) object {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.buckets == nil {
+		f.buckets = make(map[string]map[string]object)
+	}
+	if f.buckets[bucket] == nil {
+		f.buckets[bucket] = make(map[string]object)
+	}
+	obj := object{
+		body:         body,
+		etag:         fmt.Sprintf("%q", fmt.Sprintf("%x", md5.Sum(body))),
+		lastModified: time.Now().UTC(),
+	}
+	f.buckets[bucket][key] = obj
+	return obj
+}
+
+func (f *Fake) sortedKeys(bucket string) []string {
+	keys := make([]string, 0, len(f.buckets[bucket]))
+	for key := range f.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
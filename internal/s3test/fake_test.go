@@ -0,0 +1,160 @@
+package s3test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestObjects(t *testing.T) {
+	ctx := context.Background()
+	f := &Fake{}
+
+	_, err := f.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("data"),
+		Key:    aws.String("a/b.txt"),
+		Body:   strings.NewReader("hello"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	getRsp, err := f.GetObjectWithContext(ctx, &s3.GetObjectInput{Bucket: aws.String("data"), Key: aws.String("a/b.txt")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(getRsp.Body)
+	if string(body) != "hello" || aws.Int64Value(getRsp.ContentLength) != 5 {
+		t.Errorf("want: hello, got: %q (%d bytes)", body, aws.Int64Value(getRsp.ContentLength))
+	}
+
+	headRsp, err := f.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("data"), Key: aws.String("a/b.txt")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := `"5d41402abc4b2a76b9719d911017c592"`; aws.StringValue(headRsp.ETag) != want {
+		t.Errorf("want: %s, got: %s", want, aws.StringValue(headRsp.ETag))
+	}
+
+	_, err = f.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String("archive"),
+		Key:        aws.String("b copy.txt"),
+		CopySource: aws.String("data/a%2Fb.txt"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body, ok := f.Object("archive", "b copy.txt"); !ok || body != "hello" {
+		t.Errorf("want: hello, got: %q", body)
+	}
+
+	_, err = f.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{Bucket: aws.String("data"), Key: aws.String("a/b.txt")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = f.GetObject(&s3.GetObjectInput{Bucket: aws.String("data"), Key: aws.String("a/b.txt")})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != s3.ErrCodeNoSuchKey {
+		t.Errorf("want: %s, got: %v", s3.ErrCodeNoSuchKey, err)
+	}
+	_, err = f.HeadObject(&s3.HeadObjectInput{Bucket: aws.String("data"), Key: aws.String("a/b.txt")})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ErrCodeNotFound {
+		t.Errorf("want: %s, got: %v", ErrCodeNotFound, err)
+	}
+}
+
+func TestListObjectsV2(t *testing.T) {
+	f := &Fake{}
+	for _, key := range []string{"a.txt", "staging/orders/x.txt", "staging/orders/y.txt", "staging/lines/x.txt", "z.txt"} {
+		f.Put("data", key, key)
+	}
+	tests := []struct {
+		name     string
+		input    s3.ListObjectsV2Input
+		keys     []string
+		prefixes []string
+		next     string
+	}{
+		{name: "all", keys: []string{"a.txt", "staging/lines/x.txt", "staging/orders/x.txt", "staging/orders/y.txt", "z.txt"}},
+		{name: "prefix", input: s3.ListObjectsV2Input{Prefix: aws.String("staging/orders/")},
+			keys: []string{"staging/orders/x.txt", "staging/orders/y.txt"}},
+		{name: "delimiter", input: s3.ListObjectsV2Input{Delimiter: aws.String("/")},
+			keys: []string{"a.txt", "z.txt"}, prefixes: []string{"staging/"}},
+		{name: "paged", input: s3.ListObjectsV2Input{MaxKeys: aws.Int64(2)},
+			keys: []string{"a.txt", "staging/lines/x.txt"}, next: "staging/lines/x.txt"},
+		{name: "continued", input: s3.ListObjectsV2Input{MaxKeys: aws.Int64(2), ContinuationToken: aws.String("staging/lines/x.txt")},
+			keys: []string{"staging/orders/x.txt", "staging/orders/y.txt"}, next: "staging/orders/y.txt"},
+		{name: "paged-prefixes", input: s3.ListObjectsV2Input{Prefix: aws.String("staging/"), Delimiter: aws.String("/"), MaxKeys: aws.Int64(1)},
+			prefixes: []string{"staging/lines/"}, next: "staging/lines/x.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.input.Bucket = aws.String("data")
+			rsp, err := f.ListObjectsV2WithContext(context.Background(), &tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var keys, prefixes []string
+			for _, obj := range rsp.Contents {
+				keys = append(keys, aws.StringValue(obj.Key))
+			}
+			for _, prefix := range rsp.CommonPrefixes {
+				prefixes = append(prefixes, aws.StringValue(prefix.Prefix))
+			}
+			if !reflect.DeepEqual(tt.keys, keys) || !reflect.DeepEqual(tt.prefixes, prefixes) {
+				t.Errorf("want: %q %q, got: %q %q", tt.keys, tt.prefixes, keys, prefixes)
+			}
+			if next := aws.StringValue(rsp.NextContinuationToken); next != tt.next || aws.BoolValue(rsp.IsTruncated) != (tt.next != "") {
+				t.Errorf("want next: %q, got: %q", tt.next, next)
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "s3test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "nested"), 0755); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "nested", "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f := &Fake{}
+	if err := f.LoadDir("data", dir); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"nested/file.txt"}; !reflect.DeepEqual(want, f.Keys("data")) {
+		t.Errorf("want: %q, got: %q", want, f.Keys("data"))
+	}
+	if body, _ := f.Object("data", "nested/file.txt"); body != "content" {
+		t.Errorf("want: content, got: %q", body)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	f := &Fake{Err: errors.New("test_error")}
+	if _, err := f.GetObject(&s3.GetObjectInput{Bucket: aws.String("data"), Key: aws.String("a")}); err != f.Err {
+		t.Errorf("want: %v, got: %v", f.Err, err)
+	}
+
+	f = &Fake{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.PutObjectWithContext(ctx, &s3.PutObjectInput{Bucket: aws.String("data"), Key: aws.String("a")})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.OrigErr() != context.Canceled {
+		t.Errorf("want: %v, got: %v", context.Canceled, err)
+	}
+}